@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+// A char is a Scheme character.
+type char rune
+
+// charNames maps the R7RS character names to the characters they denote.
+var charNames = map[string]char{
+	"alarm":     '\a',
+	"backspace": '\b',
+	"delete":    0x7f,
+	"escape":    0x1b,
+	"newline":   '\n',
+	"null":      0,
+	"return":    '\r',
+	"space":     ' ',
+	"tab":       '\t',
+}
+
+// parseChar decodes a character literal token such as #\a, #\space or #\x41.
+func parseChar(token string) (interface{}, error) {
+	name := []rune(token[2:])
+	if len(name) == 1 {
+		return char(name[0]), nil
+	}
+	if c, ok := charNames[string(name)]; ok {
+		return c, nil
+	}
+	if name[0] == 'x' {
+		if n, err := strconv.ParseUint(string(name[1:]), 16, 32); err == nil && isScalarValue(int(n)) {
+			return char(n), nil
+		}
+	}
+	return nil, fmt.Errorf("Eval: unknown character literal '%s'", token)
+}
+
+// isScalarValue reports whether n is a Unicode code point other than a
+// surrogate, and so may be a char.
+func isScalarValue(n int) bool {
+	return n >= 0 && n <= unicode.MaxRune && !(n >= 0xd800 && n <= 0xdfff)
+}
+
+// writeChar returns the character literal for c.
+func writeChar(c char) string {
+	for name, named := range charNames {
+		if c == named {
+			return `#\` + name
+		}
+	}
+	if !unicode.IsPrint(rune(c)) {
+		return fmt.Sprintf(`#\x%x`, rune(c))
+	}
+	return `#\` + string(rune(c))
+}
+
+// createCharPredicate returns a procedure that tests a character with f.
+func createCharPredicate(name string, f func(r rune) bool) *proc {
+	return &proc{
+		[]string{"c"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if c, ok := env.vars["c"].(char); ok {
+				return f(rune(c)), nil
+			} else {
+				return nil, createTypeError(name, "char", env.vars["c"])
+			}
+		},
+		nil,
+	}
+}
+
+// createCharCompareProc returns a procedure that checks that each pair of
+// adjacent character arguments satisfies cmp.
+func createCharCompareProc(name string, cmp func(a, b char) bool) *proc {
+	return &proc{
+		[]string{"chars"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			args := env.vars["chars"].([]interface{})
+			if len(args) == 0 {
+				return nil, fmt.Errorf("Eval: procedure '%s' expected at least 1 argument, got 0", name)
+			}
+			for _, arg := range args {
+				if _, ok := arg.(char); !ok {
+					return nil, createTypeError(name, "char", arg)
+				}
+			}
+			for i := 0; i+1 < len(args); i++ {
+				if !cmp(args[i].(char), args[i+1].(char)) {
+					return false, nil
+				}
+			}
+			return true, nil
+		},
+		nil,
+	}
+}
+
+var charEnv = map[string]interface{}{
+	"char?": &proc{
+		[]string{"a"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			_, ok := env.vars["a"].(char)
+			return ok, nil
+		},
+		nil,
+	},
+
+	"char->integer": &proc{
+		[]string{"c"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if c, ok := env.vars["c"].(char); ok {
+				return int(c), nil
+			} else {
+				return nil, createTypeError("char->integer", "char", env.vars["c"])
+			}
+		},
+		nil,
+	},
+
+	"integer->char": &proc{
+		[]string{"n"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			n, ok := env.vars["n"].(int)
+			if !ok {
+				return nil, createTypeError("integer->char", "int", env.vars["n"])
+			}
+			if !isScalarValue(n) {
+				return nil, fmt.Errorf("Eval: procedure 'integer->char' got %d, which is not a Unicode scalar value", n)
+			}
+			return char(n), nil
+		},
+		nil,
+	},
+
+	"char-alphabetic?": createCharPredicate("char-alphabetic?", unicode.IsLetter),
+	"char-numeric?":    createCharPredicate("char-numeric?", unicode.IsDigit),
+	"char-whitespace?": createCharPredicate("char-whitespace?", unicode.IsSpace),
+	"char-upper-case?": createCharPredicate("char-upper-case?", unicode.IsUpper),
+	"char-lower-case?": createCharPredicate("char-lower-case?", unicode.IsLower),
+
+	"char-upcase": &proc{
+		[]string{"c"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if c, ok := env.vars["c"].(char); ok {
+				return char(unicode.ToUpper(rune(c))), nil
+			} else {
+				return nil, createTypeError("char-upcase", "char", env.vars["c"])
+			}
+		},
+		nil,
+	},
+
+	"char-downcase": &proc{
+		[]string{"c"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if c, ok := env.vars["c"].(char); ok {
+				return char(unicode.ToLower(rune(c))), nil
+			} else {
+				return nil, createTypeError("char-downcase", "char", env.vars["c"])
+			}
+		},
+		nil,
+	},
+
+	"char=?":  createCharCompareProc("char=?", func(a, b char) bool { return a == b }),
+	"char<?":  createCharCompareProc("char<?", func(a, b char) bool { return a < b }),
+	"char>?":  createCharCompareProc("char>?", func(a, b char) bool { return a > b }),
+	"char<=?": createCharCompareProc("char<=?", func(a, b char) bool { return a <= b }),
+	"char>=?": createCharCompareProc("char>=?", func(a, b char) bool { return a >= b }),
+	"char-ci=?": createCharCompareProc("char-ci=?", func(a, b char) bool {
+		return unicode.ToLower(rune(a)) == unicode.ToLower(rune(b))
+	}),
+}
+
+func init() {
+	for name, v := range charEnv {
+		defaultEnv[name] = v
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+)
+
+// A frame is a computation waiting for a value: when the expression being
+// evaluated returns, the evaluator continues by calling then with its value,
+// and then next. wind is the dynamic extent the expression is evaluated in,
+// and handlers the exception handlers installed for it. Frames are never
+// changed once made, so the stack of frames at any point can be kept as a
+// continuation.
+type frame struct {
+	then     func(v interface{}) (interface{}, error)
+	next     *frame
+	wind     *winding
+	handlers *handler
+}
+
+// push returns the frames k with a frame for then on top, in the same
+// dynamic environment.
+func (k *frame) push(then func(v interface{}) (interface{}, error)) *frame {
+	return &frame{then, k, windingOf(k), handlersOf(k)}
+}
+
+// A winding is the dynamic extent of a call to dynamic-wind's thunk, nested
+// in next: before is called whenever control enters it, and after whenever
+// control leaves it, both with the handlers of the call to dynamic-wind.
+type winding struct {
+	before, after interface{}
+	next          *winding
+	handlers      *handler
+	depth         int
+}
+
+// windingOf returns the dynamic extent that the frames k are in.
+func windingOf(k *frame) *winding {
+	if k == nil {
+		return nil
+	}
+	return k.wind
+}
+
+// handlersOf returns the exception handlers installed for the frames k.
+func handlersOf(k *frame) *handler {
+	if k == nil {
+		return nil
+	}
+	return k.handlers
+}
+
+func (w *winding) level() int {
+	if w == nil {
+		return 0
+	}
+	return w.depth
+}
+
+// A continuation is a procedure that abandons the computation it is called
+// in, and resumes the one it was captured from with its argument as the
+// value of the call/cc that captured it.
+type continuation struct {
+	k *frame
+}
+
+// A withContinuation asks the evaluator to call it with the current
+// continuation, and continue with the step it returns.
+type withContinuation func(c continuation) (interface{}, error)
+
+// A continueWith asks the evaluator to replace its stack of frames with k,
+// and return v to it.
+type continueWith struct {
+	k *frame
+	v interface{}
+}
+
+// A windThen asks the evaluator to call thunk in a new dynamic extent with
+// the before and after thunks, then call after and return thunk's value. The
+// caller has called before already.
+type windThen struct {
+	before, thunk, after interface{}
+}
+
+// unwind returns the frames k without those in the innermost dynamic extent
+// they are in, so that its after thunk can be called outside of it.
+func unwind(k *frame) *frame {
+	outer := windingOf(k).next
+	for windingOf(k) != outer {
+		k = k.next
+	}
+	return k
+}
+
+// rewind returns the frames to call the next before or after thunk with on
+// the way from the dynamic extent of k to that of the continuation c, along
+// with the thunk. The frames return to c, so that it rewinds further, or
+// resumes once in its extent.
+func rewind(k *frame, c continueWith) (*frame, interface{}) {
+	from, to := windingOf(k), windingOf(c.k)
+	// find the extent that both are in
+	common, w := from, to
+	for common.level() > w.level() {
+		common = common.next
+	}
+	for w.level() > common.level() {
+		w = w.next
+	}
+	for common != w {
+		common, w = common.next, w.next
+	}
+	resume := func(interface{}) (interface{}, error) {
+		return c, nil
+	}
+	if from != common {
+		// leave the innermost extent
+		return &frame{resume, unwind(k), from.next, from.handlers}, from.after
+	}
+	// enter the outermost extent of c that is not entered yet
+	enter := to
+	for enter.next != common {
+		enter = enter.next
+	}
+	inside := c.k
+	for windingOf(inside) != enter {
+		inside = inside.next
+	}
+	return &frame{resume, inside, common, enter.handlers}, enter.before
+}
+
+// isStep reports whether v is a step for run to perform, rather than a
+// value.
+func isStep(v interface{}) bool {
+	switch v.(type) {
+	case tailCall, evalThen, applyThen, stepThen, windThen, withHandler, raising, withContinuation, continueWith:
+		return true
+	default:
+		return false
+	}
+}
+
+// run performs step and the steps that follow from it, with a stack of
+// frames that starts empty, and returns the value that the last frame
+// returns. Control leaving or entering dynamic extents, by a continuation or
+// an error, calls their after or before thunks on the way. An error is
+// raised as an exception if there is a handler for it.
+func run(step interface{}) (interface{}, error) {
+	var k *frame
+	var err error
+	for {
+		switch s := step.(type) {
+		case tailCall:
+			step, err = evalStep(s.expr, s.env)
+		case evalThen:
+			k = k.push(s.then)
+			step, err = evalStep(s.expr, s.env)
+		case applyThen:
+			if s.then != nil {
+				k = k.push(s.then)
+			}
+			step, err = applyStep(s.f, s.args)
+		case stepThen:
+			k = k.push(s.then)
+			step = s.step
+		case windThen:
+			after := s.after
+			w := &winding{s.before, after, windingOf(k), handlersOf(k), windingOf(k).level() + 1}
+			k = &frame{func(v interface{}) (interface{}, error) {
+				return applyThen{after, []interface{}{}, func(interface{}) (interface{}, error) {
+					return v, nil
+				}}, nil
+			}, k, w, handlersOf(k)}
+			step, err = applyStep(s.thunk, []interface{}{})
+		case withHandler:
+			k = &frame{returnValue, k, windingOf(k), &handler{s.handler, handlersOf(k)}}
+			step, err = applyStep(s.thunk, []interface{}{})
+		case raising:
+			h := handlersOf(k)
+			if h == nil {
+				err = uncaught(s.obj)
+				break
+			}
+			// call the handler with the handlers outside of it installed
+			if s.continuable {
+				k = &frame{returnValue, k, windingOf(k), h.next}
+			} else {
+				obj := s.obj
+				k = &frame{returnValue, k, windingOf(k), h.next}
+				k = &frame{func(interface{}) (interface{}, error) {
+					return nil, fmt.Errorf("Eval: exception handler returned from non-continuable raise of '%s'", writeString(obj))
+				}, k, windingOf(k), h.next}
+			}
+			step, err = applyStep(h.proc, []interface{}{s.obj})
+		case withContinuation:
+			step, err = s(continuation{k})
+		case continueWith:
+			if windingOf(k) == windingOf(s.k) {
+				k, step = s.k, s.v
+				break
+			}
+			var thunk interface{}
+			k, thunk = rewind(k, s)
+			step, err = applyStep(thunk, []interface{}{})
+		default:
+			// step is a value: return it to the innermost frame
+			if k == nil {
+				return step, nil
+			}
+			then := k.then
+			k = k.next
+			step, err = then(step)
+		}
+		for err != nil {
+			if _, ok := err.(unhandled); !ok && handlersOf(k) != nil {
+				step, err = raising{condition(err), false}, nil
+				break
+			}
+			if windingOf(k) == nil {
+				if u, ok := err.(unhandled); ok {
+					return nil, u.err
+				}
+				return nil, err
+			}
+			// call the after thunk of the innermost extent, then go on
+			// returning the error, which is no longer for the handlers
+			// outside of it
+			failure, w := err, windingOf(k)
+			if _, ok := err.(unhandled); !ok {
+				failure = unhandled{err}
+			}
+			k = &frame{func(interface{}) (interface{}, error) {
+				return nil, failure
+			}, unwind(k), w.next, w.handlers}
+			step, err = applyStep(w.after, []interface{}{})
+		}
+	}
+}
+
+var continuationEnv = map[string]interface{}{
+	// (dynamic-wind before thunk after) calls thunk, calling before whenever
+	// control enters the call and after whenever it leaves, whether by
+	// returning, by a continuation or by an error
+	"dynamic-wind": &proc{
+		[]string{"before", "thunk", "after"},
+		arity{3, 0, false},
+		func(env *Env) (interface{}, error) {
+			before, thunk, after := env.vars["before"], env.vars["thunk"], env.vars["after"]
+			return applyThen{before, []interface{}{}, func(interface{}) (interface{}, error) {
+				return windThen{before, thunk, after}, nil
+			}}, nil
+		},
+		nil,
+	},
+
+	// (call-with-current-continuation f) calls f with the continuation of the
+	// call
+	"call-with-current-continuation": &proc{
+		[]string{"f"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			f := env.vars["f"]
+			return withContinuation(func(c continuation) (interface{}, error) {
+				return applyThen{f, []interface{}{c}, nil}, nil
+			}), nil
+		},
+		nil,
+	},
+}
+
+func init() {
+	continuationEnv["call/cc"] = continuationEnv["call-with-current-continuation"]
+	for name, v := range continuationEnv {
+		defaultEnv[name] = v
+	}
+}
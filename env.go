@@ -2,245 +2,407 @@ package main
 
 import (
 	"fmt"
+	"math/big"
 	"math/rand"
 	"time"
 )
 
-func copyEnv(src map[string]interface{}) map[string]interface{} {
-	copy := make(map[string]interface{})
-	for k := range src {
-		copy[k] = src[k]
+// An Env is a frame of bindings linked to the frame it extends. Looking up a
+// name searches the frame and then each enclosing frame in turn.
+type Env struct {
+	vars  map[string]interface{}
+	outer *Env
+}
+
+func NewEnv(outer *Env) *Env {
+	return &Env{make(map[string]interface{}), outer}
+}
+
+// Lookup returns the value bound to name in the nearest frame that binds it.
+func (e *Env) Lookup(name string) (interface{}, bool) {
+	for ; e != nil; e = e.outer {
+		if v, ok := e.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Define binds name to v in this frame, shadowing any outer binding.
+func (e *Env) Define(name string, v interface{}) {
+	e.vars[name] = v
+}
+
+// Set rebinds name to v in the nearest frame that binds it, and reports
+// whether there was such a frame.
+func (e *Env) Set(name string, v interface{}) bool {
+	for ; e != nil; e = e.outer {
+		if _, ok := e.vars[name]; ok {
+			e.vars[name] = v
+			return true
+		}
+	}
+	return false
+}
+
+// unassigned is the value of a variable of letrec or letrec* before its
+// init has been assigned to it. Referring to the variable then is an error.
+type unassigned struct{}
+
+// newGlobalEnv returns a top-level environment holding the builtins.
+func newGlobalEnv() *Env {
+	env := NewEnv(nil)
+	for k, v := range defaultEnv {
+		env.Define(k, v)
 	}
-	return copy
+	return env
 }
 
+// createTypeError returns an error object for a builtin given an argument
+// of the wrong type, with the argument as the irritant.
 func createTypeError(name string, expectedType string, actual interface{}) error {
-	return fmt.Errorf(
-		"Eval: procedure '%s' expected argument type '%s', but got '%T'",
-		name, expectedType, actual)
+	return &errorObject{
+		fmt.Sprintf("procedure '%s' expected argument type '%s', but got '%T'", name, expectedType, actual),
+		[]interface{}{actual},
+	}
 }
 
 func createArgLenError(name string, expected int, args []interface{}) error {
-	return fmt.Errorf(
-		"Eval: procedure '%v' expected %d arguments, but got %d arguments",
-		name, expected, len(args))
+	return &errorObject{
+		fmt.Sprintf("procedure '%v' expected %d arguments, but got %d arguments", name, expected, len(args)),
+		nil,
+	}
 }
 
-func createIntBinaryProc(name string, bf func(a, b int) interface{}) proc {
-	return proc{
-		[]string{"a", "b"},
-		func(env map[string]interface{}) (interface{}, error) {
-			a, ok := env["a"].(int)
-			if !ok {
-				return nil, createTypeError(name, "int", env["a"])
-			}
-			b, ok := env["b"].(int)
-			if !ok {
-				return nil, createTypeError(name, "int", env["b"])
-			}
-			return bf(a, b), nil
-		},
+// identifierName returns expr as a name to bind if it is an identifier, and
+// not a list or a literal token such as a number or string.
+func identifierName(expr interface{}) (string, bool) {
+	if a, ok := expr.(*alias); ok {
+		return a.key, true
+	}
+	s, ok := expr.(string)
+	return s, ok && isIdentifier(s)
+}
+
+func createNameError(name string, actual interface{}) error {
+	if s, ok := actual.(string); ok {
+		return fmt.Errorf("Eval: procedure '%s' expected an identifier, but got literal '%s'", name, s)
 	}
+	return fmt.Errorf("Eval: procedure '%s' expected an identifier, but got '%T'", name, actual)
+}
+
+// sliceToList returns a list of the given elements, built from pairs.
+func sliceToList(elements []interface{}) interface{} {
+	return sliceToDottedList(elements, emptyList{})
+}
+
+// listToSlice returns the elements of the list v, or false if v is not a
+// proper list.
+func listToSlice(v interface{}) ([]interface{}, bool) {
+	n, ok := listLength(v)
+	if !ok {
+		return nil, false
+	}
+	elements := make([]interface{}, n)
+	for i := range elements {
+		p := v.(*pair)
+		elements[i] = p.car
+		v = p.cdr
+	}
+	return elements, true
 }
 
 var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
 
+// parseBindings returns the names and inits of the bindings ((name init)
+// ...) of the special form name.
+func parseBindings(name string, bindingList interface{}) ([]string, []interface{}, error) {
+	defs, ok := bindingList.([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("Eval: procedure '%s' expected type '[]interface{}' for bindings, got '%T'", name, bindingList)
+	}
+	names := make([]string, len(defs))
+	inits := make([]interface{}, len(defs))
+	for i, def := range defs {
+		pair, ok := def.([]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("Eval: procedure '%s' expected a definition of type 'list', but got '%T'", name, def)
+		}
+		if len(pair) != 2 {
+			return nil, nil, fmt.Errorf("Eval: procedure '%s' expected a definition list of length 2, but got %d", name, len(pair))
+		}
+		if names[i], ok = identifierName(pair[0]); !ok {
+			return nil, nil, createNameError(name, pair[0])
+		}
+		inits[i] = pair[1]
+	}
+	return names, inits, nil
+}
+
+// bindEach evaluates inits in turn, binding each to its name in a new
+// environment extending the last, then evaluates body in the innermost.
+func bindEach(names []string, inits []interface{}, body []interface{}, env *Env) (interface{}, error) {
+	if len(inits) == 0 {
+		return evalBody(body, NewEnv(env))
+	}
+	return evalThen{inits[0], env, func(v interface{}) (interface{}, error) {
+		if err := singleValue("let*", v); err != nil {
+			return nil, err
+		}
+		bindingEnv := NewEnv(env)
+		bindingEnv.Define(names[0], v)
+		return bindEach(names[1:], inits[1:], body, bindingEnv)
+	}}, nil
+}
+
+// assignEach evaluates inits in env in turn, assigning each to its name in
+// env, then continues with then.
+func assignEach(names []string, inits []interface{}, env *Env, then func() (interface{}, error)) (interface{}, error) {
+	if len(inits) == 0 {
+		return then()
+	}
+	return evalThen{inits[0], env, func(v interface{}) (interface{}, error) {
+		if err := singleValue("letrec*", v); err != nil {
+			return nil, err
+		}
+		env.Define(names[0], v)
+		return assignEach(names[1:], inits[1:], env, then)
+	}}, nil
+}
+
+// evalCond evaluates the clauses of a cond expression in turn, continuing
+// with the first whose test is true: with its body in order, with the value
+// of the test for a clause (test), or with a call of receiver on it for a
+// clause (test => receiver). Tests must be booleans, and only the last clause
+// may be an else clause. If no test is true, evalCond continues with
+// otherwise. name is the form reported in errors.
+func evalCond(name string, clauses []interface{}, env *Env, otherwise func() (interface{}, error)) (interface{}, error) {
+	if len(clauses) == 0 {
+		return otherwise()
+	}
+	clause, ok := clauses[0].([]interface{})
+	if !ok || len(clause) == 0 {
+		return nil, fmt.Errorf("Eval: procedure '%s' expected a clause (test body ...), but got '%s'", name, writeExpr(clauses[0]))
+	}
+	if isKeyword(clause[0], "else") {
+		if len(clauses) != 1 || len(clause) == 1 {
+			return nil, fmt.Errorf("Eval: procedure '%s' expected a last clause (else body ...), but got '%s'", name, writeExpr(clauses[0]))
+		}
+		return evalSequence(clause[1:], env)
+	}
+	return evalThenStep(clause[0], env, func(v interface{}) (interface{}, error) {
+		test, ok := v.(bool)
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("Eval: procedure '%s' expected 'bool' type for condition, got '%T'", name, v)
+		case !test:
+			return evalCond(name, clauses[1:], env, otherwise)
+		case len(clause) == 1:
+			return v, nil
+		case isKeyword(clause[1], "=>"):
+			if len(clause) != 3 {
+				return nil, fmt.Errorf("Eval: procedure '%s' expected a clause (test => receiver), but got '%s'", name, writeExpr(clause))
+			}
+			return evalThenStep(clause[2], env, func(receiver interface{}) (interface{}, error) {
+				return applyThen{receiver, []interface{}{v}, nil}, nil
+			})
+		default:
+			return evalSequence(clause[1:], env)
+		}
+	})
+}
+
 var defaultEnv = map[string]interface{}{
 	// return random integer in [0, n)
-	"random": proc{
+	"random": &proc{
 		[]string{"n"},
-		func(env map[string]interface{}) (interface{}, error) {
-			if n, ok := env["n"].(int); ok {
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			switch n := env.vars["n"].(type) {
+			case int:
+				if n <= 0 {
+					return nil, fmt.Errorf("Eval: procedure 'random' expected a positive integer, but got %d", n)
+				}
 				return rng.Intn(n), nil
-			} else {
-				return nil, createTypeError("random", "int", env["n"])
+			case *big.Int:
+				if n.Sign() <= 0 {
+					return nil, fmt.Errorf("Eval: procedure 'random' expected a positive integer, but got %v", n)
+				}
+				return normalizeBig(new(big.Int).Rand(rng, n)), nil
+			default:
+				return nil, createTypeError("random", "integer", env.vars["n"])
 			}
 		},
+		nil,
 	},
 
-	"cons": proc{
+	"cons": &proc{
 		[]string{"a", "b"},
-		func(env map[string]interface{}) (interface{}, error) {
-			return [2]interface{}{env["a"], env["b"]}, nil
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			return &pair{env.vars["a"], env.vars["b"]}, nil
 		},
+		nil,
 	},
 
-	"car": proc{
+	"car": &proc{
 		[]string{"a"},
-		func(env map[string]interface{}) (interface{}, error) {
-			if a, ok := env["a"].([2]interface{}); ok {
-				return a[0], nil
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if a, ok := env.vars["a"].(*pair); ok {
+				return a.car, nil
 			} else {
-				return nil, createTypeError("car", "[2]interface{}", env["a"])
+				return nil, createTypeError("car", "pair", env.vars["a"])
 			}
 		},
+		nil,
 	},
 
-	"cdr": proc{
+	"cdr": &proc{
 		[]string{"a"},
-		func(env map[string]interface{}) (interface{}, error) {
-			if a, ok := env["a"].([2]interface{}); ok {
-				return a[1], nil
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if a, ok := env.vars["a"].(*pair); ok {
+				return a.cdr, nil
 			} else {
-				return nil, createTypeError("cdr", "[2]interface{}", env["a"])
+				return nil, createTypeError("cdr", "pair", env.vars["a"])
 			}
 		},
+		nil,
 	},
 
-	"null?": proc{
+	"null?": &proc{
 		[]string{"a"},
-		func(env map[string]interface{}) (interface{}, error) {
-			if a, ok := env["a"].([2]interface{}); ok {
-				return a == [2]interface{}{nil, nil}, nil
-			} else {
-				return nil, createTypeError("null?", "[2]interface{}", env["a"])
-			}
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			_, ok := env.vars["a"].(emptyList)
+			return ok, nil
 		},
+		nil,
 	},
 
-	"list": variadicProc{
-		"elements",
-		func(env map[string]interface{}) (interface{}, error) {
-			elements := env["elements"].([]interface{})
-			result := [2]interface{}{nil, nil}
-			for i := len(elements) - 1; i >= 0; i-- {
-				result = [2]interface{}{elements[i], result}
-			}
-			return result, nil
+	"list": &proc{
+		[]string{"elements"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			return sliceToList(env.vars["elements"].([]interface{})), nil
 		},
+		nil,
 	},
 
-	"+": variadicProc{
-		"nums",
-		func(env map[string]interface{}) (interface{}, error) {
-			result := 0
-			nums := env["nums"].([]interface{})
-			for _, inum := range nums {
-				if num, ok := inum.(int); ok {
-					result += num
-				} else {
-					return nil, createTypeError("+", "int", inum)
-				}
-			}
-			return result, nil
-		},
-	},
-
-	"*": variadicProc{
-		"nums",
-		func(env map[string]interface{}) (interface{}, error) {
-			result := 1
-			nums := env["nums"].([]interface{})
-			for _, inum := range nums {
-				if num, ok := inum.(int); ok {
-					result *= num
-				} else {
-					return nil, createTypeError("*", "int", inum)
-				}
-			}
-			return result, nil
-		},
-	},
-
-	"not": proc{
+	"not": &proc{
 		[]string{"a"},
-		func(env map[string]interface{}) (interface{}, error) {
-			if a, ok := env["a"].(bool); ok {
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if a, ok := env.vars["a"].(bool); ok {
 				return !a, nil
 			} else {
-				return nil, createTypeError("not", "bool", env["a"])
+				return nil, createTypeError("not", "bool", env.vars["a"])
 			}
 		},
+		nil,
 	},
 
-	"and": proc{
+	"and": &proc{
 		[]string{"a", "b"},
-		func(env map[string]interface{}) (interface{}, error) {
-			a, ok := env["a"].(bool)
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			a, ok := env.vars["a"].(bool)
 			if !ok {
-				return nil, createTypeError("and", "bool", env["a"])
+				return nil, createTypeError("and", "bool", env.vars["a"])
 			}
-			b, ok := env["b"].(bool)
+			b, ok := env.vars["b"].(bool)
 			if !ok {
-				return nil, createTypeError("and", "bool", env["b"])
+				return nil, createTypeError("and", "bool", env.vars["b"])
 			}
 			return a && b, nil
 		},
+		nil,
 	},
 
-	"or": proc{
+	"or": &proc{
 		[]string{"a", "b"},
-		func(env map[string]interface{}) (interface{}, error) {
-			a, ok := env["a"].(bool)
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			a, ok := env.vars["a"].(bool)
 			if !ok {
-				return nil, createTypeError("or", "bool", env["a"])
+				return nil, createTypeError("or", "bool", env.vars["a"])
 			}
-			b, ok := env["b"].(bool)
+			b, ok := env.vars["b"].(bool)
 			if !ok {
-				return nil, createTypeError("or", "bool", env["b"])
+				return nil, createTypeError("or", "bool", env.vars["b"])
 			}
 			return a || b, nil
 		},
+		nil,
 	},
 
-	"-":         createIntBinaryProc("-", func(a, b int) interface{} { return a - b }),
-	"/":         createIntBinaryProc("/", func(a, b int) interface{} { return a / b }),
-	">":         createIntBinaryProc(">", func(a, b int) interface{} { return a > b }),
-	">=":        createIntBinaryProc(">=", func(a, b int) interface{} { return a >= b }),
-	"<":         createIntBinaryProc("<", func(a, b int) interface{} { return a < b }),
-	"<=":        createIntBinaryProc("<=", func(a, b int) interface{} { return a <= b }),
-	"=":         createIntBinaryProc("=", func(a, b int) interface{} { return a == b }),
-	"remainder": createIntBinaryProc("remainder", func(a, b int) interface{} { return a % b }),
-
+	// (define name value), or (define (name . params) body ...) for
+	// (define name (lambda params body ...)), where name may be a header
+	// itself to define a procedure that returns a procedure
 	// modifies given env
-	"define": specialForm(func(args []interface{}, env map[string]interface{}) (interface{}, error) {
+	"define": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) >= 2 {
+			target, body := args[0], args[1:]
+			for {
+				header, ok := target.([]interface{})
+				if !ok {
+					break
+				}
+				if len(header) == 0 {
+					return nil, fmt.Errorf("Eval: procedure 'define' expected a name in the header, but got '()'")
+				}
+				lambda := append([]interface{}{&specialForm{evalLambda}, header[1:]}, body...)
+				target, body = header[0], []interface{}{lambda}
+			}
+			args = []interface{}{target, body[0]}
+		}
 		if len(args) != 2 {
 			return nil, createArgLenError("define", 2, args)
 		}
 
-		name := args[0].(string)
-		value := args[1]
-		val, err := Eval(value, env)
-		if err != nil {
-			return nil, err
+		name, ok := identifierName(args[0])
+		if !ok {
+			return nil, createNameError("define", args[0])
 		}
-		env[name] = val
-		return nil, nil
-	}),
+		value := args[1]
+		return evalThen{value, env, func(val interface{}) (interface{}, error) {
+			if err := singleValue("define", val); err != nil {
+				return nil, err
+			}
+			env.Define(name, val)
+			return nil, nil
+		}}, nil
+	}},
 
-	"lambda": specialForm(func(args []interface{}, env map[string]interface{}) (interface{}, error) {
+	// modifies the env that binds the name
+	"set!": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
 		if len(args) != 2 {
-			return nil, createArgLenError("lambda", 2, args)
+			return nil, createArgLenError("set!", 2, args)
 		}
 
-		if params, ok := args[0].([]interface{}); ok {
-			stringParams := make([]string, len(params))
-			for i := range params {
-				if param, ok := params[i].(string); ok {
-					stringParams[i] = param
-				} else {
-					return nil, fmt.Errorf("Eval: procedure 'lambda' expected 'string' parameter names, got '%T'", params[i])
-				}
-			}
-			return proc{
-				stringParams,
-				func(env map[string]interface{}) (interface{}, error) {
-					return Eval(args[1], env)
-				},
-			}, nil
-		} else if param, ok := args[0].(string); ok { // variadic args
-			return variadicProc{
-				param,
-				func(env map[string]interface{}) (interface{}, error) {
-					return Eval(args[1], env)
-				},
-			}, nil
-		} else {
-			return nil, fmt.Errorf("Eval: procedure 'lambda' expected 'list' or 'string' type for first argument, got '%T'", args[0])
+		if _, ok := identifierName(args[0]); !ok {
+			return nil, createNameError("set!", args[0])
 		}
-	}),
+		return evalThen{args[1], env, func(val interface{}) (interface{}, error) {
+			if err := singleValue("set!", val); err != nil {
+				return nil, err
+			}
+			name, bindingEnv := resolve(args[0], env)
+			if !bindingEnv.Set(name, val) {
+				return nil, fmt.Errorf("Eval: procedure 'set!' cannot assign unbound identifier '%s'", baseName(args[0]))
+			}
+			return nil, nil
+		}}, nil
+	}},
+
+	// (lambda params body ...)
+	"lambda": &specialForm{evalLambda},
 
-	"if": specialForm(func(args []interface{}, env map[string]interface{}) (interface{}, error) {
+	// (case-lambda (params body ...) ...)
+	"case-lambda": &specialForm{evalCaseLambda},
+
+	"if": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
 		if len(args) != 3 {
 			return nil, createArgLenError("if", 3, args)
 		}
@@ -248,122 +410,136 @@ var defaultEnv = map[string]interface{}{
 		condition := args[0]
 		conseq := args[1]
 		alt := args[2]
-		conditionVal, err := Eval(condition, env)
-		if err != nil {
-			return nil, err
-		}
-		conditionBool, ok := conditionVal.(bool)
-		if !ok {
-			return nil, fmt.Errorf("Eval: procedure 'if' expected 'bool' type for condition, got '%T'", conditionVal)
-		}
-		if conditionBool {
-			return Eval(conseq, env)
-		} else {
-			return Eval(alt, env)
-		}
-	}),
-
-	"cond": specialForm(func(args []interface{}, env map[string]interface{}) (interface{}, error) {
-		if len(args) == 0 {
-			return nil, fmt.Errorf("Eval: procedure 'cond' expected at least 1 argument, got 0")
-		}
-
-		// check n - 1 branches
-		for _, arg := range args[:len(args)-1] {
-			branch, ok := arg.([]interface{})
-			if !ok {
-				return nil, fmt.Errorf("Eval: procedure 'cond' expected 'list' type for argument, got '%T'", arg)
-			}
-
-			if len(branch) != 2 {
-				return nil, fmt.Errorf("Eval: procedure 'cond' expected 2 items in a branch, got %d", len(branch))
-			}
-			condition := branch[0]
-			body := branch[1]
-
-			conditionVal, err := Eval(condition, env)
-			if err != nil {
-				return nil, err
-			}
+		return evalThenStep(condition, env, func(conditionVal interface{}) (interface{}, error) {
 			conditionBool, ok := conditionVal.(bool)
 			if !ok {
-				return nil, fmt.Errorf("Eval: procedure 'cond' expected 'bool' type for condition, got '%T'", conditionVal)
+				return nil, fmt.Errorf("Eval: procedure 'if' expected 'bool' type for condition, got '%T'", conditionVal)
 			}
 			if conditionBool {
-				return Eval(body, env)
+				return tailCall{conseq, env}, nil
+			} else {
+				return tailCall{alt, env}, nil
 			}
+		})
+	}},
+
+	"cond": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("Eval: procedure 'cond' expected at least 1 argument, got 0")
 		}
 
-		// check last branch for 'else'
-		branch, ok := args[len(args)-1].([]interface{})
-		if !ok {
-			return nil, fmt.Errorf("Eval: procedure 'cond' expected 'list' type for argument, got '%T'", args[len(args)-1])
+		return evalCond("cond", args, env, func() (interface{}, error) {
+			return nil, fmt.Errorf("Eval: no branch matched in 'cond' procedure")
+		})
+	}},
+
+	"begin": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, nil
 		}
-		if len(branch) != 2 {
-			return nil, fmt.Errorf("Eval: procedure 'cond' expected 2 items in a branch, got %d", len(branch))
+		return evalSequence(args, env)
+	}},
+
+	// (let ((name init) ...) body ...), or the named let (let loop ((name
+	// init) ...) body ...), which binds loop in body to a procedure of the
+	// names with body as its body
+	"let": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("Eval: procedure 'let' expected at least 2 arguments, but got %d arguments", len(args))
 		}
-		condition := branch[0]
-		body := branch[1]
-		if scond, ok := condition.(string); ok && (scond == "else") {
-			return Eval(body, env)
-		} else {
-			conditionVal, err := Eval(condition, env)
+
+		if loop, ok := identifierName(args[0]); ok {
+			if len(args) < 3 {
+				return nil, fmt.Errorf("Eval: procedure 'let' expected at least 3 arguments, but got %d arguments", len(args))
+			}
+			names, inits, err := parseBindings("let", args[1])
 			if err != nil {
 				return nil, err
 			}
-			conditionBool, ok := conditionVal.(bool)
-			if !ok {
-				return nil, fmt.Errorf("Eval: procedure 'cond' expected 'bool' type for condition, got '%T'", conditionVal)
-			}
-			if conditionBool {
-				return Eval(body, env)
+			params := make([]interface{}, len(names))
+			for i, def := range args[1].([]interface{}) {
+				params[i] = def.([]interface{})[0]
 			}
-		}
-		return nil, fmt.Errorf("Eval: no branch matched in 'cond' procedure")
-	}),
-
-	"begin": specialForm(func(args []interface{}, env map[string]interface{}) (interface{}, error) {
-		beginEnv := copyEnv(env)
-		var retval interface{} = nil
-		for _, arg := range args {
-			var err error
-			retval, err = Eval(arg, beginEnv)
+			loopEnv := NewEnv(env)
+			f, err := createLambda("let", params, args[2:], loopEnv)
 			if err != nil {
 				return nil, err
 			}
+			loopEnv.Define(loop, f)
+			return evalList(inits, env, make([]interface{}, 0, len(inits)), func(vals []interface{}) (interface{}, error) {
+				return applyStep(f, vals)
+			})
 		}
-		return retval, nil
-	}),
 
-	"let": specialForm(func(args []interface{}, env map[string]interface{}) (interface{}, error) {
-		if len(args) != 2 {
-			return nil, createArgLenError("let", 2, args)
-		}
-
-		letEnv := copyEnv(env)
-		defs, ok := args[0].([]interface{})
-		if !ok {
-			return nil, fmt.Errorf("Eval: procedure 'let' expected type '[]interface{}' for arg 1, got '%T'", args[0])
+		names, inits, err := parseBindings("let", args[0])
+		if err != nil {
+			return nil, err
 		}
-		for _, def := range defs {
-			pair, ok := def.([]interface{})
-			if !ok {
-				return nil, fmt.Errorf("Eval: procedure 'let' expected a definition of type 'list', but got '%T'", def)
-			}
-			if len(pair) != 2 {
-				return nil, fmt.Errorf("Eval: procedure 'let' expected a definition list of length 2, but got %d", len(pair))
-			}
-			name, ok := pair[0].(string)
-			if !ok {
-				return nil, fmt.Errorf("Eval: procedure 'let' expected a definition name of type 'string', but got '%T'", pair[0])
+		return evalList(inits, env, make([]interface{}, 0, len(inits)), func(vals []interface{}) (interface{}, error) {
+			letEnv := NewEnv(env)
+			for i, name := range names {
+				if err := singleValue("let", vals[i]); err != nil {
+					return nil, err
+				}
+				letEnv.Define(name, vals[i])
 			}
-			value := pair[1]
-			v, err := Eval(value, env)
-			if err != nil {
-				return nil, err
+			return evalBody(args[1:], letEnv)
+		})
+	}},
+
+	// like let, but each init is evaluated with the bindings before it
+	"let*": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("Eval: procedure 'let*' expected at least 2 arguments, but got %d arguments", len(args))
+		}
+		names, inits, err := parseBindings("let*", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return bindEach(names, inits, args[1:], env)
+	}},
+
+	// like let, but the inits are evaluated with all of the bindings, so
+	// that procedures can refer to each other
+	"letrec": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("Eval: procedure 'letrec' expected at least 2 arguments, but got %d arguments", len(args))
+		}
+		names, inits, err := parseBindings("letrec", args[0])
+		if err != nil {
+			return nil, err
+		}
+		letEnv := NewEnv(env)
+		for _, name := range names {
+			letEnv.Define(name, unassigned{})
+		}
+		return evalList(inits, letEnv, make([]interface{}, 0, len(inits)), func(vals []interface{}) (interface{}, error) {
+			for i, name := range names {
+				if err := singleValue("letrec", vals[i]); err != nil {
+					return nil, err
+				}
+				letEnv.Define(name, vals[i])
 			}
-			letEnv[name] = v
+			return evalBody(args[1:], letEnv)
+		})
+	}},
+
+	// like letrec, but each init is evaluated and assigned in turn, so that
+	// it can use the values before it
+	"letrec*": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("Eval: procedure 'letrec*' expected at least 2 arguments, but got %d arguments", len(args))
+		}
+		names, inits, err := parseBindings("letrec*", args[0])
+		if err != nil {
+			return nil, err
+		}
+		letEnv := NewEnv(env)
+		for _, name := range names {
+			letEnv.Define(name, unassigned{})
 		}
-		return Eval(args[1], letEnv)
-	}),
+		return assignEach(names, inits, letEnv, func() (interface{}, error) {
+			return evalBody(args[1:], letEnv)
+		})
+	}},
 }
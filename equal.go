@@ -0,0 +1,187 @@
+package main
+
+import (
+	"math"
+	"math/big"
+)
+
+// eqv reports whether a and b are the same object: equal atoms, numbers of
+// the same exactness and value, or the same pair, vector, hash table or
+// procedure.
+func eqv(a, b interface{}) bool {
+	switch a := a.(type) {
+	case *big.Int:
+		b, ok := b.(*big.Int)
+		return ok && a.Cmp(b) == 0
+	case *big.Rat:
+		b, ok := b.(*big.Rat)
+		return ok && a.Cmp(b) == 0
+	case float64:
+		// compare bits, so that -0.0 and 0.0 differ but NaN is itself
+		b, ok := b.(float64)
+		return ok && math.Float64bits(a) == math.Float64bits(b)
+	case multipleValues:
+		// not comparable with ==, so compare the values in turn
+		b, ok := b.(multipleValues)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !eqv(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		// the remaining types are comparable, and compare by identity
+		// where they are pointers
+		return a == b
+	}
+}
+
+// equal reports whether a and b have the same structure: pairs and vectors
+// are compared element by element, and everything else by eqv. It
+// terminates on circular structures.
+func equal(a, b interface{}) bool {
+	return sameStructure(a, b, map[[2]interface{}]bool{})
+}
+
+// sameStructure compares a and b as for equal. seen holds the pairs and
+// vectors already under comparison: meeting one again means the structures
+// are circular, and have matched all the way around the cycle.
+func sameStructure(a, b interface{}, seen map[[2]interface{}]bool) bool {
+	// loop over the cdrs of lists, so long lists do not recurse deeply
+	for {
+		switch x := a.(type) {
+		case *pair:
+			y, ok := b.(*pair)
+			if !ok {
+				return false
+			}
+			if seen[[2]interface{}{x, y}] {
+				return true
+			}
+			seen[[2]interface{}{x, y}] = true
+			if !sameStructure(x.car, y.car, seen) {
+				return false
+			}
+			a, b = x.cdr, y.cdr
+		case *vector:
+			y, ok := b.(*vector)
+			if !ok || len(x.elements) != len(y.elements) {
+				return false
+			}
+			if seen[[2]interface{}{x, y}] {
+				return true
+			}
+			seen[[2]interface{}{x, y}] = true
+			for i := range x.elements {
+				if !sameStructure(x.elements[i], y.elements[i], seen) {
+					return false
+				}
+			}
+			return true
+		default:
+			return eqv(a, b)
+		}
+	}
+}
+
+// createEquivalenceProc returns a procedure that tests its two arguments
+// with same.
+func createEquivalenceProc(same func(a, b interface{}) bool) *proc {
+	return &proc{
+		[]string{"a", "b"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			return same(env.vars["a"], env.vars["b"]), nil
+		},
+		nil,
+	}
+}
+
+// createMemberProc returns a procedure that finds the first element of a
+// list that is the same as an object, and returns the list from that
+// element on. If key is true, it instead finds the first pair in a list of
+// pairs whose car is the same, as assoc does. If custom is true, the
+// procedure takes an optional third argument to compare with instead of
+// same.
+func createMemberProc(name string, same func(a, b interface{}) bool, key, custom bool) *proc {
+	optional := 0
+	if custom {
+		optional = 1
+	}
+	return &proc{
+		[]string{"obj", "list", "compare"},
+		arity{2, optional, false},
+		func(env *Env) (interface{}, error) {
+			obj := env.vars["obj"]
+			compare, given := env.vars["compare"]
+			var search func(l interface{}) (interface{}, error)
+			search = func(l interface{}) (interface{}, error) {
+				for {
+					if _, ok := l.(emptyList); ok {
+						return false, nil
+					}
+					p, ok := l.(*pair)
+					if !ok {
+						return nil, createTypeError(name, "list", env.vars["list"])
+					}
+					element := p.car
+					if key {
+						entry, ok := element.(*pair)
+						if !ok {
+							return nil, createTypeError(name, "pair", element)
+						}
+						element = entry.car
+					}
+					if given {
+						// continue the search once the call returns
+						return applyThen{compare, []interface{}{obj, element}, func(v interface{}) (interface{}, error) {
+							if v == false {
+								return search(p.cdr)
+							} else if key {
+								return p.car, nil
+							}
+							return l, nil
+						}}, nil
+					}
+					if same(obj, element) && key {
+						return p.car, nil
+					} else if same(obj, element) {
+						return l, nil
+					}
+					l = p.cdr
+				}
+			}
+			return search(env.vars["list"])
+		},
+		nil,
+	}
+}
+
+var equalEnv = map[string]interface{}{
+	// strings are values rather than objects with a location, so eq? does
+	// not tell apart strings with the same contents
+	"eq?":    createEquivalenceProc(eqv),
+	"eqv?":   createEquivalenceProc(eqv),
+	"equal?": createEquivalenceProc(equal),
+
+	// (memq obj list) returns the first sublist of list whose car is obj,
+	// or #f
+	"memq":   createMemberProc("memq", eqv, false, false),
+	"memv":   createMemberProc("memv", eqv, false, false),
+	"member": createMemberProc("member", equal, false, true),
+
+	// (assq obj alist) returns the first pair in alist whose car is obj, or
+	// #f
+	"assq":  createMemberProc("assq", eqv, true, false),
+	"assv":  createMemberProc("assv", eqv, true, false),
+	"assoc": createMemberProc("assoc", equal, true, true),
+}
+
+func init() {
+	for name, v := range equalEnv {
+		defaultEnv[name] = v
+	}
+}
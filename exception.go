@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An errorObject is a Scheme error object, as made by the error procedure.
+// It is also the error that builtins return, so that errors are raised as
+// error objects that programs can handle, and report message and irritants
+// if nothing does.
+type errorObject struct {
+	message   string
+	irritants []interface{}
+}
+
+// Error reports the message followed by the irritants as written by
+// writeString, which labels a circular irritant rather than following it.
+func (e *errorObject) Error() string {
+	strs := []string{"Eval: " + e.message}
+	for _, irritant := range e.irritants {
+		strs = append(strs, writeString(irritant))
+	}
+	return strings.Join(strs, " ")
+}
+
+// A raisedObject is the error for an object other than an error object that
+// was raised with no handler to handle it.
+type raisedObject struct {
+	obj interface{}
+}
+
+func (e raisedObject) Error() string {
+	return fmt.Sprintf("Eval: uncaught exception '%s'", writeString(e.obj))
+}
+
+// An unhandled wraps an error that no handler handled, while the evaluator
+// calls the after thunks of the dynamic extents it leaves.
+type unhandled struct {
+	err error
+}
+
+func (e unhandled) Error() string {
+	return e.err.Error()
+}
+
+// uncaught returns the error for obj raised with no handler.
+func uncaught(obj interface{}) error {
+	if e, ok := obj.(*errorObject); ok {
+		return e
+	}
+	return raisedObject{obj}
+}
+
+// condition returns the object to raise for err, the inverse of uncaught.
+// Errors from builtins that are not error objects already are made into
+// error objects with the error's text as the message.
+func condition(err error) interface{} {
+	switch e := err.(type) {
+	case *errorObject:
+		return e
+	case raisedObject:
+		return e.obj
+	default:
+		return &errorObject{strings.TrimPrefix(err.Error(), "Eval: "), nil}
+	}
+}
+
+// A handler is an exception handler installed by with-exception-handler,
+// within the handlers installed outside of it.
+type handler struct {
+	proc interface{}
+	next *handler
+}
+
+// A withHandler asks the evaluator to call thunk with handler installed.
+type withHandler struct {
+	handler, thunk interface{}
+}
+
+// A raising asks the evaluator to call the current handler with obj, with
+// the handlers outside of it installed. If continuable is true the
+// handler's value is the value of the raise, and otherwise the handler
+// returning is an error.
+type raising struct {
+	obj         interface{}
+	continuable bool
+}
+
+func returnValue(v interface{}) (interface{}, error) {
+	return v, nil
+}
+
+// guardClauses returns the step that evaluates the clauses of a guard
+// expression in env with the condition bound to name, as the clauses of a
+// cond expression. If no clause matches, reraise continues with the step that
+// raises the condition again.
+func guardClauses(name string, clauses []interface{}, env *Env, condition interface{}, reraise func() (interface{}, error)) (interface{}, error) {
+	clauseEnv := NewEnv(env)
+	clauseEnv.Define(name, condition)
+	return evalCond("guard", clauses, clauseEnv, reraise)
+}
+
+var exceptionEnv = map[string]interface{}{
+	// (with-exception-handler handler thunk) calls thunk with handler
+	// installed, to be called with any object raised during the call
+	"with-exception-handler": &proc{
+		[]string{"handler", "thunk"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			return withHandler{env.vars["handler"], env.vars["thunk"]}, nil
+		},
+		nil,
+	},
+
+	"raise": &proc{
+		[]string{"obj"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			return raising{env.vars["obj"], false}, nil
+		},
+		nil,
+	},
+
+	// (raise-continuable obj) raises obj, and returns the value the handler
+	// returns
+	"raise-continuable": &proc{
+		[]string{"obj"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			return raising{env.vars["obj"], true}, nil
+		},
+		nil,
+	},
+
+	// (error message irritant ...) raises an error object
+	"error": &proc{
+		[]string{"args"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			args := env.vars["args"].([]interface{})
+			if len(args) == 0 {
+				return nil, fmt.Errorf("Eval: procedure 'error' expected at least 1 argument, got 0")
+			}
+			message, ok := args[0].(str)
+			if !ok {
+				return nil, createTypeError("error", "string", args[0])
+			}
+			return nil, &errorObject{string(message), append([]interface{}{}, args[1:]...)}
+		},
+		nil,
+	},
+
+	"error-object?": &proc{
+		[]string{"a"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			_, ok := env.vars["a"].(*errorObject)
+			return ok, nil
+		},
+		nil,
+	},
+
+	"error-object-message": &proc{
+		[]string{"e"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if e, ok := env.vars["e"].(*errorObject); ok {
+				return str(e.message), nil
+			} else {
+				return nil, createTypeError("error-object-message", "error-object", env.vars["e"])
+			}
+		},
+		nil,
+	},
+
+	"error-object-irritants": &proc{
+		[]string{"e"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if e, ok := env.vars["e"].(*errorObject); ok {
+				return sliceToList(e.irritants), nil
+			} else {
+				return nil, createTypeError("error-object-irritants", "error-object", env.vars["e"])
+			}
+		},
+		nil,
+	},
+
+	// (guard (var clause ...) body ...) evaluates body, and if it raises an
+	// object, evaluates the clauses as cond clauses with the object bound to
+	// var. If no clause matches, the object is raised again where it was
+	// raised, with raise-continuable.
+	"guard": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("Eval: procedure 'guard' expected at least 2 arguments, but got %d arguments", len(args))
+		}
+		spec, ok := args[0].([]interface{})
+		if !ok || len(spec) == 0 {
+			return nil, fmt.Errorf("Eval: procedure 'guard' expected (var clause ...), but got '%s'", writeExpr(args[0]))
+		}
+		name, ok := identifierName(spec[0])
+		if !ok {
+			return nil, createNameError("guard", spec[0])
+		}
+		clauses := spec[1:]
+		body := &proc{
+			[]string{},
+			arity{0, 0, false},
+			func(*Env) (interface{}, error) {
+				return evalBody(args[1:], NewEnv(env))
+			},
+			nil,
+		}
+		return withContinuation(func(guardK continuation) (interface{}, error) {
+			// the handler returns to the continuation of the guard to
+			// evaluate the clauses, and back to its own to reraise
+			guardHandler := &proc{
+				[]string{"condition"},
+				arity{1, 0, false},
+				func(handlerEnv *Env) (interface{}, error) {
+					condition := handlerEnv.vars["condition"]
+					return withContinuation(func(raiseK continuation) (interface{}, error) {
+						reraise := func() (interface{}, error) {
+							return continueWith{raiseK.k.push(func(interface{}) (interface{}, error) {
+								return raising{condition, true}, nil
+							}), nil}, nil
+						}
+						return continueWith{guardK.k.push(func(interface{}) (interface{}, error) {
+							return guardClauses(name, clauses, env, condition, reraise)
+						}), nil}, nil
+					}), nil
+				},
+				nil,
+			}
+			return withHandler{guardHandler, body}, nil
+		}), nil
+	}},
+}
+
+func init() {
+	for name, v := range exceptionEnv {
+		defaultEnv[name] = v
+	}
+}
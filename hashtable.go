@@ -0,0 +1,372 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// A hashTable maps keys to values, comparing keys with same. Go maps can
+// only compare keys with ==, which tells apart equal? lists and vectors, so
+// entries are kept in buckets by their hash, which must be equal for keys
+// that are the same.
+type hashTable struct {
+	buckets map[uint64][]*tableEntry
+	same    func(a, b interface{}) bool
+	hash    func(v interface{}) uint64
+	size    int
+}
+
+type tableEntry struct {
+	key, value interface{}
+}
+
+func newHashTable(same func(a, b interface{}) bool, hash func(v interface{}) uint64) *hashTable {
+	return &hashTable{make(map[uint64][]*tableEntry), same, hash, 0}
+}
+
+// lookup returns the entry for key, or nil if there is none.
+func (t *hashTable) lookup(key interface{}) *tableEntry {
+	for _, e := range t.buckets[t.hash(key)] {
+		if t.same(e.key, key) {
+			return e
+		}
+	}
+	return nil
+}
+
+func (t *hashTable) set(key, value interface{}) {
+	if e := t.lookup(key); e != nil {
+		e.value = value
+		return
+	}
+	h := t.hash(key)
+	t.buckets[h] = append(t.buckets[h], &tableEntry{key, value})
+	t.size++
+}
+
+func (t *hashTable) delete(key interface{}) {
+	h := t.hash(key)
+	bucket := t.buckets[h]
+	for i, e := range bucket {
+		if t.same(e.key, key) {
+			bucket = append(bucket[:i:i], bucket[i+1:]...)
+			if len(bucket) == 0 {
+				delete(t.buckets, h)
+			} else {
+				t.buckets[h] = bucket
+			}
+			t.size--
+			return
+		}
+	}
+}
+
+// entries returns the table's entries, in no particular order. The slice is
+// a copy, so the table may be changed while ranging over it.
+func (t *hashTable) entries() []*tableEntry {
+	entries := make([]*tableEntry, 0, t.size)
+	for _, bucket := range t.buckets {
+		entries = append(entries, bucket...)
+	}
+	return entries
+}
+
+// hashEqv returns a hash of v for tables compared by eqv, so pairs, vectors
+// and procedures hash by identity.
+func hashEqv(v interface{}) uint64 {
+	h := fnv.New64a()
+	switch v := v.(type) {
+	case *pair, *vector, *hashTable, *errorObject, *proc, *specialForm, *macro, *procMacro:
+		fmt.Fprintf(h, "%p", v)
+	case float64:
+		fmt.Fprintf(h, "%T %x", v, math.Float64bits(v))
+	case multipleValues:
+		fmt.Fprintf(h, "%T", v)
+		for _, value := range v {
+			fmt.Fprintf(h, " %x", hashEqv(value))
+		}
+	default:
+		// the remaining types print by value
+		fmt.Fprintf(h, "%T %v", v, v)
+	}
+	return h.Sum64()
+}
+
+// maxHashNodes bounds the number of pairs and vector elements hashEqual
+// visits, so that it terminates on circular structures.
+const maxHashNodes = 64
+
+// hashEqual returns a hash of v for tables compared by equal, which combines
+// the hashes of the elements of pairs and vectors.
+func hashEqual(v interface{}) uint64 {
+	budget := maxHashNodes
+	return hashStructure(v, &budget)
+}
+
+func hashStructure(v interface{}, budget *int) uint64 {
+	if *budget <= 0 {
+		return 0
+	}
+	switch v := v.(type) {
+	case *pair:
+		*budget--
+		return 31*hashStructure(v.car, budget) + hashStructure(v.cdr, budget) + 1
+	case *vector:
+		h := uint64(len(v.elements))
+		for _, element := range v.elements {
+			*budget--
+			h = 31*h + hashStructure(element, budget)
+		}
+		return h
+	default:
+		return hashEqv(v)
+	}
+}
+
+// tableRef continues by calling then with the value for key in t, or the
+// result of calling failure if there is none, or returns an error if failure
+// is nil.
+func tableRef(name string, t *hashTable, key interface{}, failure interface{}, then func(v interface{}) (interface{}, error)) (interface{}, error) {
+	if e := t.lookup(key); e != nil {
+		return then(e.value)
+	}
+	if failure == nil {
+		return nil, fmt.Errorf("Eval: procedure '%s' found no value for key '%s'", name, writeString(key))
+	}
+	return applyThen{failure, []interface{}{}, then}, nil
+}
+
+// walkEntries calls f on the key and value of each of entries in turn.
+func walkEntries(f interface{}, entries []*tableEntry) (interface{}, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return applyThen{f, []interface{}{entries[0].key, entries[0].value}, func(interface{}) (interface{}, error) {
+		return walkEntries(f, entries[1:])
+	}}, nil
+}
+
+var hashTableEnv = map[string]interface{}{
+	// (make-hash-table [equivalence]) where equivalence is one of eq?, eqv?
+	// and equal?, the default
+	"make-hash-table": &proc{
+		[]string{"equivalence"},
+		arity{0, 1, false},
+		func(env *Env) (interface{}, error) {
+			equivalence, given := env.vars["equivalence"]
+			if !given || eqv(equivalence, equalEnv["equal?"]) {
+				return newHashTable(equal, hashEqual), nil
+			}
+			if eqv(equivalence, equalEnv["eq?"]) || eqv(equivalence, equalEnv["eqv?"]) {
+				return newHashTable(eqv, hashEqv), nil
+			}
+			return nil, fmt.Errorf("Eval: procedure 'make-hash-table' expected eq?, eqv? or equal?, but got '%s'", writeString(equivalence))
+		},
+		nil,
+	},
+
+	"hash-table?": &proc{
+		[]string{"a"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			_, ok := env.vars["a"].(*hashTable)
+			return ok, nil
+		},
+		nil,
+	},
+
+	"hash-table-set!": &proc{
+		[]string{"t", "key", "value"},
+		arity{3, 0, false},
+		func(env *Env) (interface{}, error) {
+			t, ok := env.vars["t"].(*hashTable)
+			if !ok {
+				return nil, createTypeError("hash-table-set!", "hash-table", env.vars["t"])
+			}
+			t.set(env.vars["key"], env.vars["value"])
+			return nil, nil
+		},
+		nil,
+	},
+
+	// (hash-table-ref t key [failure [success]]) returns the value for key,
+	// passed to success if given, or the result of calling the thunk
+	// failure if there is none
+	"hash-table-ref": &proc{
+		[]string{"t", "key", "failure", "success"},
+		arity{2, 2, false},
+		func(env *Env) (interface{}, error) {
+			t, ok := env.vars["t"].(*hashTable)
+			if !ok {
+				return nil, createTypeError("hash-table-ref", "hash-table", env.vars["t"])
+			}
+			key := env.vars["key"]
+			if success, given := env.vars["success"]; given {
+				if e := t.lookup(key); e != nil {
+					return applyThen{success, []interface{}{e.value}, nil}, nil
+				}
+			}
+			return tableRef("hash-table-ref", t, key, env.vars["failure"], func(v interface{}) (interface{}, error) {
+				return v, nil
+			})
+		},
+		nil,
+	},
+
+	"hash-table-ref/default": &proc{
+		[]string{"t", "key", "default"},
+		arity{3, 0, false},
+		func(env *Env) (interface{}, error) {
+			t, ok := env.vars["t"].(*hashTable)
+			if !ok {
+				return nil, createTypeError("hash-table-ref/default", "hash-table", env.vars["t"])
+			}
+			if e := t.lookup(env.vars["key"]); e != nil {
+				return e.value, nil
+			}
+			return env.vars["default"], nil
+		},
+		nil,
+	},
+
+	"hash-table-contains?": &proc{
+		[]string{"t", "key"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			t, ok := env.vars["t"].(*hashTable)
+			if !ok {
+				return nil, createTypeError("hash-table-contains?", "hash-table", env.vars["t"])
+			}
+			return t.lookup(env.vars["key"]) != nil, nil
+		},
+		nil,
+	},
+
+	"hash-table-delete!": &proc{
+		[]string{"t", "key"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			t, ok := env.vars["t"].(*hashTable)
+			if !ok {
+				return nil, createTypeError("hash-table-delete!", "hash-table", env.vars["t"])
+			}
+			t.delete(env.vars["key"])
+			return nil, nil
+		},
+		nil,
+	},
+
+	"hash-table-size": &proc{
+		[]string{"t"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if t, ok := env.vars["t"].(*hashTable); ok {
+				return t.size, nil
+			} else {
+				return nil, createTypeError("hash-table-size", "hash-table", env.vars["t"])
+			}
+		},
+		nil,
+	},
+
+	// (hash-table-update! t key f [failure]) sets the value for key to the
+	// result of calling f on its value, which is looked up as by
+	// hash-table-ref
+	"hash-table-update!": &proc{
+		[]string{"t", "key", "f", "failure"},
+		arity{3, 1, false},
+		func(env *Env) (interface{}, error) {
+			t, ok := env.vars["t"].(*hashTable)
+			if !ok {
+				return nil, createTypeError("hash-table-update!", "hash-table", env.vars["t"])
+			}
+			key := env.vars["key"]
+			return tableRef("hash-table-update!", t, key, env.vars["failure"], func(v interface{}) (interface{}, error) {
+				return applyThen{env.vars["f"], []interface{}{v}, func(v interface{}) (interface{}, error) {
+					if err := singleValue("hash-table-update!", v); err != nil {
+						return nil, err
+					}
+					t.set(key, v)
+					return nil, nil
+				}}, nil
+			})
+		},
+		nil,
+	},
+
+	// (hash-table-walk t f) calls f on each key and value
+	"hash-table-walk": &proc{
+		[]string{"t", "f"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			t, ok := env.vars["t"].(*hashTable)
+			if !ok {
+				return nil, createTypeError("hash-table-walk", "hash-table", env.vars["t"])
+			}
+			return walkEntries(env.vars["f"], t.entries())
+		},
+		nil,
+	},
+
+	"hash-table-keys": &proc{
+		[]string{"t"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			t, ok := env.vars["t"].(*hashTable)
+			if !ok {
+				return nil, createTypeError("hash-table-keys", "hash-table", env.vars["t"])
+			}
+			entries := t.entries()
+			keys := make([]interface{}, len(entries))
+			for i, e := range entries {
+				keys[i] = e.key
+			}
+			return sliceToList(keys), nil
+		},
+		nil,
+	},
+
+	"hash-table-values": &proc{
+		[]string{"t"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			t, ok := env.vars["t"].(*hashTable)
+			if !ok {
+				return nil, createTypeError("hash-table-values", "hash-table", env.vars["t"])
+			}
+			entries := t.entries()
+			values := make([]interface{}, len(entries))
+			for i, e := range entries {
+				values[i] = e.value
+			}
+			return sliceToList(values), nil
+		},
+		nil,
+	},
+
+	// (hash-table->alist t) returns a list of (key . value) pairs
+	"hash-table->alist": &proc{
+		[]string{"t"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			t, ok := env.vars["t"].(*hashTable)
+			if !ok {
+				return nil, createTypeError("hash-table->alist", "hash-table", env.vars["t"])
+			}
+			entries := t.entries()
+			alist := make([]interface{}, len(entries))
+			for i, e := range entries {
+				alist[i] = &pair{e.key, e.value}
+			}
+			return sliceToList(alist), nil
+		},
+		nil,
+	},
+}
+
+func init() {
+	for name, v := range hashTableEnv {
+		defaultEnv[name] = v
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+)
+
+// optionalMarker separates the required parameters of a parameter list from
+// the optional ones.
+const optionalMarker = "#!optional"
+
+// argsName is the name a case-lambda procedure binds its arguments to. It is
+// not an identifier, so the clauses cannot refer to it.
+const argsName = "#args"
+
+// params describes a parameter list (required ... [#!optional optional ...]
+// [. rest]). Each optional parameter is a name, or a list (name default) of
+// the name and an expression for its value when there is no argument for
+// it, which is evaluated with the parameters before it bound. Without a
+// default, the value is #f. rest is empty if there is no rest parameter.
+type params struct {
+	required []string
+	optional []string
+	defaults []interface{}
+	rest     string
+}
+
+// parseParams returns the parameters that the parameter list lst describes,
+// for the special form name.
+func parseParams(name string, lst []interface{}) (params, error) {
+	// a dot may come first, before a rest parameter alone
+	fixed, tail, err := splitDottedList(append([]interface{}{"_"}, lst...))
+	if err != nil {
+		return params{}, err
+	}
+	fixed = fixed[1:]
+	var p params
+	optional := false
+	for _, param := range fixed {
+		if param == optionalMarker && !optional {
+			optional = true
+			continue
+		}
+		if !optional {
+			id, ok := identifierName(param)
+			if !ok {
+				return params{}, createNameError(name, param)
+			}
+			p.required = append(p.required, id)
+			continue
+		}
+		var def interface{}
+		if withDefault, ok := param.([]interface{}); ok && len(withDefault) == 2 {
+			param, def = withDefault[0], withDefault[1]
+		}
+		id, ok := identifierName(param)
+		if !ok {
+			return params{}, createNameError(name, param)
+		}
+		p.optional = append(p.optional, id)
+		p.defaults = append(p.defaults, def)
+	}
+	if tail != nil {
+		var ok bool
+		if p.rest, ok = identifierName(tail); !ok {
+			return params{}, createNameError(name, tail)
+		}
+	}
+	return p, nil
+}
+
+// bindOptional binds each optional parameter of p from the ith on that has
+// no argument bound to it in env to its default, then continues with then.
+func bindOptional(p params, i int, env *Env, then func() (interface{}, error)) (interface{}, error) {
+	for ; i < len(p.optional); i++ {
+		if _, ok := env.vars[p.optional[i]]; ok {
+			continue
+		}
+		if p.defaults[i] == nil {
+			env.Define(p.optional[i], false)
+			continue
+		}
+		next := i + 1
+		name := p.optional[i]
+		return evalThen{p.defaults[i], env, func(v interface{}) (interface{}, error) {
+			if err := singleValue("lambda", v); err != nil {
+				return nil, err
+			}
+			env.Define(name, v)
+			return bindOptional(p, next, env, then)
+		}}, nil
+	}
+	return then()
+}
+
+// createLambda returns the procedure with the parameter list lst and body
+// created in env, for the special form name. lst is a list of parameters,
+// or a single identifier to bind a list of all of the arguments to.
+func createLambda(name string, lst interface{}, body []interface{}, env *Env) (*proc, error) {
+	var p params
+	if param, ok := identifierName(lst); ok {
+		p.rest = param
+	} else if paramList, ok := lst.([]interface{}); ok {
+		var err error
+		if p, err = parseParams(name, paramList); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("Eval: procedure '%s' expected 'list' or 'string' type for parameters, got '%T'", name, lst)
+	}
+	names := append(append([]string{}, p.required...), p.optional...)
+	if p.rest != "" {
+		names = append(names, p.rest)
+	}
+	defined := bodyDefinitions(body)
+	evalProcBody := func(procEnv *Env) (interface{}, error) {
+		return evalBodyWith(defined, body, procEnv)
+	}
+	if len(p.optional) == 0 && p.rest == "" {
+		return &proc{names, arity{len(p.required), 0, false}, evalProcBody, env}, nil
+	}
+	return &proc{
+		names,
+		arity{len(p.required), len(p.optional), p.rest != ""},
+		func(procEnv *Env) (interface{}, error) {
+			if p.rest != "" {
+				procEnv.Define(p.rest, sliceToList(procEnv.vars[p.rest].([]interface{})))
+			}
+			return bindOptional(p, 0, procEnv, func() (interface{}, error) {
+				return evalProcBody(procEnv)
+			})
+		},
+		env,
+	}, nil
+}
+
+// evalLambda is the lambda special form, (lambda params body ...).
+func evalLambda(args []interface{}, env *Env) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("Eval: procedure 'lambda' expected at least 2 arguments, but got %d arguments", len(args))
+	}
+	return createLambda("lambda", args[0], args[1:], env)
+}
+
+// evalCaseLambda is the case-lambda special form, (case-lambda (params body
+// ...) ...). Its procedure calls the first clause whose parameters accept
+// the number of arguments it is called with.
+func evalCaseLambda(args []interface{}, env *Env) (interface{}, error) {
+	clauses := make([]*proc, len(args))
+	for i, arg := range args {
+		clause, ok := arg.([]interface{})
+		if !ok || len(clause) < 2 {
+			return nil, fmt.Errorf("Eval: procedure 'case-lambda' expected (params body ...), but got '%s'", writeExpr(arg))
+		}
+		var err error
+		if clauses[i], err = createLambda("case-lambda", clause[0], clause[1:], env); err != nil {
+			return nil, err
+		}
+	}
+	return &proc{
+		[]string{argsName},
+		arity{0, 0, true},
+		func(procEnv *Env) (interface{}, error) {
+			args := procEnv.vars[argsName].([]interface{})
+			for _, clause := range clauses {
+				if clause.arity.accepts(len(args)) {
+					return applyThen{clause, args, nil}, nil
+				}
+			}
+			return nil, fmt.Errorf("Eval: procedure 'case-lambda' has no clause for %d arguments", len(args))
+		},
+		env,
+	}, nil
+}
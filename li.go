@@ -4,26 +4,33 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
-	"strconv"
 	"strings"
 )
 
 var (
 	ErrUnrecognizedToken      = errors.New("Lex: unrecognized token")
+	ErrIncompleteString       = errors.New("Lex: incomplete string literal")
+	ErrMalformedNumber        = errors.New("Lex: malformed number")
 	ErrIncompleteExpression   = errors.New("Parse: incomplete expression")
 	ErrOvercompleteExpression = errors.New("Parse: overcomplete expression")
+	ErrMissingDatum           = errors.New("Parse: expected expression after quote prefix")
 )
 
 func Lex(src string) ([]string, error) {
 	// declare regexp strings
 	reStrings := []string{
-		`(#t)|(#f)`,                  // boolean literals
-		`[(]|[)]`,                    // parens
-		`[123456789]\d*`,             // integer literals
-		`\+|\-|\*|/|<|>|(<=)|(>=)|=`, // operators
-		`(\w|\-|\?)+`,                // identifiers
-		`;.*`,                        // single-line comments
-		`((?s)[[:space:]]+)`,         // whitespace
+		`"(?s:\\.|[^"\\])*"`,                 // string literals
+		`#\\(x[[:xdigit:]]+|[[:alpha:]]+|.)`, // character literals
+		`(#t)|(#f)`,                          // boolean literals
+		`#?[(]|[)]`,                          // parens and vector openers
+		`'|\x60|,@?`,                         // quote prefixes
+		`[+-]?\.?\d[^\s()";'\x60,]*`,         // numerals
+		`#[bodxeiBODXEI][^\s()";'\x60,]*`,    // numerals with prefixes
+		`[+-](inf|nan)\.0`,                   // infinities and NaN
+		`#!optional`,                         // parameter list marker
+		`[\w!$%&*/:<=>?^+\-.@]+`,             // identifiers and operators
+		`;.*`,                                // single-line comments
+		`((?s)[[:space:]]+)`,                 // whitespace
 	}
 
 	// compile strings to regexp objects
@@ -42,7 +49,13 @@ func Lex(src string) ([]string, error) {
 		for _, re := range regexes {
 			loc := re.FindStringIndex(src[i:])
 			if loc != nil && loc[0] == 0 {
-				tokens = append(tokens, src[i:][loc[0]:loc[1]])
+				token := src[i:][loc[0]:loc[1]]
+				if isNumeral(token) {
+					if _, ok := parseNumber(token, 10); !ok {
+						return nil, ErrMalformedNumber
+					}
+				}
+				tokens = append(tokens, token)
 				reMatched = true
 				i += (loc[1] - loc[0])
 				break
@@ -51,6 +64,9 @@ func Lex(src string) ([]string, error) {
 
 		// error if no regex can match current input
 		if !reMatched {
+			if src[i] == '"' {
+				return nil, ErrIncompleteString
+			}
 			return nil, ErrUnrecognizedToken
 		}
 	}
@@ -58,6 +74,32 @@ func Lex(src string) ([]string, error) {
 	return tokens, nil
 }
 
+var numeralPattern = regexp.MustCompile(`^([+-]?\.?\d|#[bodxeiBODXEI]|[+-](inf|nan)\.0$)`)
+
+// isNumeral reports whether token has the shape of a number, and so must be
+// a valid number rather than an identifier.
+func isNumeral(token string) bool {
+	// most tokens are identifiers, so rule them out without the regexp,
+	// which evaluating an identifier would otherwise run each time
+	switch c := token[0]; {
+	case c >= '0' && c <= '9':
+		return true
+	case c != '+' && c != '-' && c != '.' && c != '#':
+		// only a sign, a dot or a prefix can come before the digits
+		return false
+	case len(token) == 1:
+		// +, - and . alone have no digits
+		return false
+	}
+	return numeralPattern.MatchString(token)
+}
+
+// isIdentifier reports whether token names a binding rather than being a
+// literal. A lone dot marks the tail of a dotted list, and is neither.
+func isIdentifier(token string) bool {
+	return token[0] != '"' && token[0] != '#' && token != "." && !isNumeral(token)
+}
+
 // Remove whitespace and comment tokens
 func Preprocess(tokens []string) []string {
 	preprocessedTokens := make([]string, 0, len(tokens))
@@ -73,24 +115,68 @@ func Preprocess(tokens []string) []string {
 	return preprocessedTokens
 }
 
+// abbreviations maps the quote prefixes to the special forms they
+// abbreviate, so that 'x parses as (quote x).
+var abbreviations = map[string]string{
+	"'":  "quote",
+	"`":  "quasiquote",
+	",":  "unquote",
+	",@": "unquote-splicing",
+}
+
+// A vectorLiteral is the expression for a vector literal such as #(1 2 3),
+// which evaluates to a vector of its elements as data.
+type vectorLiteral []interface{}
+
 func Parse(tokens []string) ([]interface{}, error) {
 	stk := NewStack()
 	stk.Push(NewStack())
+	// openers[i] is the token that opened the i'th expression on stk: a paren,
+	// a vector opener or a quote prefix, whose expression is complete once it
+	// holds one datum
+	openers := []string{""}
+
+	// add datum to the innermost expression, then close any abbreviations
+	// it completes
+	pushDatum := func(datum interface{}) {
+		for {
+			expr := stk.Pop().(Stack)
+			expr.Push(datum)
+			if _, ok := abbreviations[openers[len(openers)-1]]; !ok {
+				stk.Push(expr)
+				return
+			}
+			openers = openers[:len(openers)-1]
+			datum = expr
+		}
+	}
+
 	for _, token := range tokens {
-		if token == "(" {
+		if name, ok := abbreviations[token]; ok {
+			expr := NewStack()
+			expr.Push(name)
+			stk.Push(expr)
+			openers = append(openers, token)
+		} else if token == "(" || token == "#(" {
 			stk.Push(NewStack())
+			openers = append(openers, token)
 		} else if token == ")" {
+			opener := openers[len(openers)-1]
+			if _, ok := abbreviations[opener]; ok {
+				return nil, ErrMissingDatum
+			}
 			childExpr := stk.Pop().(Stack)
 			if stk.Len() == 0 {
 				return nil, ErrOvercompleteExpression
 			}
-			parentExpr := stk.Pop().(Stack)
-			parentExpr.Push(childExpr)
-			stk.Push(parentExpr)
+			openers = openers[:len(openers)-1]
+			if opener == "#(" {
+				pushDatum(vectorLiteral(childExpr.ToSlice()))
+			} else {
+				pushDatum(childExpr)
+			}
 		} else {
-			expr := stk.Pop().(Stack)
-			expr.Push(token)
-			stk.Push(expr)
+			pushDatum(token)
 		}
 	}
 	if stk.Len() > 1 {
@@ -99,7 +185,19 @@ func Parse(tokens []string) ([]interface{}, error) {
 	return stk.Pop().(Stack).ToSlice(), nil
 }
 
-func Eval(expr interface{}, env map[string]interface{}) (interface{}, error) {
+// Eval evaluates expr in env. Rather than recursing on the Go stack, special
+// forms and procedure bodies return steps: a tailCall for the expression in
+// tail position, or an evalThen for a subexpression whose value they need,
+// which the evaluator keeps on a stack of frames of its own. So iterative
+// processes run in constant space, recursion is only limited by memory, and
+// call/cc can capture the rest of the computation as that stack.
+func Eval(expr interface{}, env *Env) (interface{}, error) {
+	return run(tailCall{expr, env})
+}
+
+// evalStep evaluates expr in env, except that it may return a step instead
+// of a value, as special forms do.
+func evalStep(expr interface{}, env *Env) (interface{}, error) {
 	switch expr.(type) {
 	case []interface{}:
 		// must be a function application
@@ -107,83 +205,313 @@ func Eval(expr interface{}, env map[string]interface{}) (interface{}, error) {
 		if len(lst) == 0 {
 			return nil, fmt.Errorf("Eval: cannot evaluate empty expression ()")
 		}
-		function, err := Eval(lst[0], env)
+		if _, ok := lst[0].([]interface{}); ok {
+			return evalThen{lst[0], env, func(function interface{}) (interface{}, error) {
+				return applyForm(function, lst, env)
+			}}, nil
+		}
+		function, err := evalStep(lst[0], env)
 		if err != nil {
 			return nil, err
 		}
-		switch function.(type) {
-		case specialForm:
-			return function.(specialForm)(lst[1:], env)
-		case proc:
-			proc := function.(proc)
-			args := lst[1:]
-			if len(args) != len(proc.params) {
-				return nil, fmt.Errorf("Eval: wrong number of params")
-			}
-			procEnv := copyEnv(env)
-			evaluatedArgs := make([]interface{}, len(args))
-			for i := range args {
-				evaluatedArg, err := Eval(args[i], env)
-				evaluatedArgs[i] = evaluatedArg
-				if err != nil {
-					return nil, err
-				}
-			}
-			for i := range evaluatedArgs {
-				procEnv[proc.params[i]] = evaluatedArgs[i]
-			}
-			return proc.body(procEnv)
-		case variadicProc:
-			vproc := function.(variadicProc)
-			args := lst[1:]
-			procEnv := copyEnv(env)
-			evaluatedArgs := make([]interface{}, len(args))
-			for i := range args {
-				evaluatedArg, err := Eval(args[i], env)
-				evaluatedArgs[i] = evaluatedArg
-				if err != nil {
-					return nil, err
-				}
-			}
-			procEnv[vproc.param] = evaluatedArgs
-			return vproc.body(procEnv)
-		default:
-			return nil, fmt.Errorf(
-				"Eval: expected special form or procedure but received type '%T'",
-				function)
+		return applyForm(function, lst, env)
+	case vectorLiteral:
+		return datum(expr)
+	case *alias:
+		// an identifier inserted by a macro
+		name, bindingEnv := resolve(expr, env)
+		val, ok := bindingEnv.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("Eval: identifier not found: '%s'", baseName(expr))
+		}
+		if _, ok := val.(unassigned); ok {
+			return nil, fmt.Errorf("Eval: identifier '%s' used before its value was assigned", baseName(expr))
 		}
+		return val, nil
 	case string:
 		// must be either literal or a binding
 		s := expr.(string)
-		if s == "#t" {
-			// true literal
-			return true, nil
-		} else if s == "#f" {
-			// false literal
-			return false, nil
-		} else if i, err := strconv.Atoi(s); err == nil {
-			// integer literal
-			return i, nil
+		if !isIdentifier(s) {
+			return parseLiteral(s)
+		}
+		val, ok := env.Lookup(s)
+		if !ok {
+			return nil, fmt.Errorf("Eval: identifier not found: '%s'", s)
+		} else if _, ok := val.(unassigned); ok {
+			return nil, fmt.Errorf("Eval: identifier '%s' used before its value was assigned", s)
 		} else {
-			// identifier
-			val, ok := env[s]
-			if !ok {
-				return nil, fmt.Errorf("Eval: identifier not found: '%s'", s)
-			} else {
-				return val, nil
+			return val, nil
+		}
+	default:
+		// a value that a define-macro transformer put in its expansion
+		return expr, nil
+	}
+}
+
+// applyStep calls the procedure f with args, which have already been
+// evaluated. Like evalStep, it may return a step instead of a value.
+func applyStep(f interface{}, args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if m, ok := arg.(multipleValues); ok {
+			return nil, fmt.Errorf("Eval: procedure expected a single value for each argument, but got %d values", len(m))
+		}
+	}
+	switch f := f.(type) {
+	case *proc:
+		if !f.arity.accepts(len(args)) {
+			return nil, fmt.Errorf("Eval: procedure expected %s arguments, but got %d arguments", f.arity, len(args))
+		}
+		// apply in an extension of the environment the procedure was
+		// created in, not the caller's
+		procEnv := NewEnv(f.env)
+		fixed := f.arity.required + f.arity.optional
+		for i := 0; i < len(args) && i < fixed; i++ {
+			procEnv.Define(f.params[i], args[i])
+		}
+		if f.arity.rest {
+			rest := []interface{}{}
+			if len(args) > fixed {
+				rest = args[fixed:]
 			}
+			procEnv.Define(f.params[fixed], rest)
 		}
+		return f.body(procEnv)
+	case continuation:
+		// a continuation takes any number of values
+		if len(args) == 1 {
+			return continueWith{f.k, args[0]}, nil
+		}
+		return continueWith{f.k, multipleValues(args)}, nil
 	default:
-		return nil, fmt.Errorf(`Eval: received invalid expression
-	type: '%T'
-	value: '%v'`,
-			expr, expr)
+		return nil, fmt.Errorf(
+			"Eval: expected special form or procedure but received type '%T'",
+			f)
+	}
+}
+
+// applyForm applies the value of the operator of the form lst: a special
+// form or macro is given the form, and a procedure its evaluated arguments.
+// A macro use is expanded the first time it is evaluated only.
+func applyForm(function interface{}, lst []interface{}, env *Env) (interface{}, error) {
+	if sf, ok := function.(*specialForm); ok {
+		return sf.body(lst[1:], env)
+	}
+	if e, ok := function.(*expanded); ok {
+		return tailCall{e.expansion, env}, nil
+	}
+	if t, ok := function.(transformer); ok {
+		expansion, err := t.transform(lst, env)
+		if err != nil {
+			return nil, err
+		}
+		lst[0] = &expanded{lst[0], expansion}
+		return tailCall{expansion, env}, nil
+	}
+	return evalList(lst[1:], env, make([]interface{}, 0, len(lst)-1), func(args []interface{}) (interface{}, error) {
+		return applyStep(function, args)
+	})
+}
+
+// evalInPlace evaluates expr in env without the evaluator's stack if it is
+// an identifier or literal, or a call of a builtin procedure with only those
+// as arguments, reporting whether it was. None of these can capture a
+// continuation before they return, so they need no frame to return to, and
+// are most of the expressions evaluated. The value may still be a step, if
+// the builtin returns one.
+func evalInPlace(expr interface{}, env *Env) (interface{}, bool, error) {
+	lst, ok := expr.([]interface{})
+	if !ok {
+		v, err := evalStep(expr, env)
+		return v, true, err
+	}
+	if len(lst) == 0 {
+		return nil, false, nil
+	}
+	for _, e := range lst {
+		if _, ok := e.([]interface{}); ok {
+			return nil, false, nil
+		}
+	}
+	function, err := evalStep(lst[0], env)
+	if err != nil {
+		return nil, true, err
+	}
+	if f, ok := function.(*proc); !ok || f.env != nil {
+		return nil, false, nil
+	}
+	args := make([]interface{}, len(lst)-1)
+	for i := range args {
+		if args[i], err = evalStep(lst[i+1], env); err != nil {
+			return nil, true, err
+		}
+	}
+	v, err := applyStep(function, args)
+	return v, true, err
+}
+
+// evalThenStep evaluates expr in env, then continues by calling then with
+// the value, as the step evalThen does, but evaluates in place where it can.
+func evalThenStep(expr interface{}, env *Env, then func(v interface{}) (interface{}, error)) (interface{}, error) {
+	v, ok, err := evalInPlace(expr, env)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return evalThen{expr, env, then}, nil
+	}
+	if isStep(v) {
+		return stepThen{v, then}, nil
+	}
+	return then(v)
+}
+
+// evalList evaluates exprs in env from left to right, appending their values
+// to done, then continues by calling then with the values.
+func evalList(exprs []interface{}, env *Env, done []interface{}, then func(values []interface{}) (interface{}, error)) (interface{}, error) {
+	for len(exprs) > 0 {
+		v, ok, err := evalInPlace(exprs[0], env)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || isStep(v) {
+			// evaluate on the evaluator's stack, and copy done when it
+			// returns, in case it returns more than once
+			rest := exprs[1:]
+			next := func(v interface{}) (interface{}, error) {
+				return evalList(rest, env, append(done[:len(done):len(done)], v), then)
+			}
+			if ok {
+				return stepThen{v, next}, nil
+			}
+			return evalThen{exprs[0], env, next}, nil
+		}
+		done = append(done, v)
+		exprs = exprs[1:]
+	}
+	return then(done)
+}
+
+// evalSequence evaluates exprs in env in order, continuing with the last in
+// tail position.
+func evalSequence(exprs []interface{}, env *Env) (interface{}, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	if len(exprs) == 1 {
+		return tailCall{exprs[0], env}, nil
+	}
+	return evalThenStep(exprs[0], env, func(interface{}) (interface{}, error) {
+		return evalSequence(exprs[1:], env)
+	})
+}
+
+// evalBody evaluates the body of a lambda or binding form in env, a new
+// environment for it. The variables that the definitions at the start of the
+// body define are bound in env first, so that the definitions are in the
+// scope of the body alone, and are assigned in turn as by letrec*.
+func evalBody(body []interface{}, env *Env) (interface{}, error) {
+	return evalBodyWith(bodyDefinitions(body), body, env)
+}
+
+// evalBodyWith evaluates body in env as evalBody does, given the names of its
+// definitions, for lambda to find once rather than on each call.
+func evalBodyWith(names []string, body []interface{}, env *Env) (interface{}, error) {
+	for _, name := range names {
+		env.Define(name, unassigned{})
+	}
+	return evalSequence(body, env)
+}
+
+// bodyDefinitions returns the names defined by the definitions at the start
+// of body.
+func bodyDefinitions(body []interface{}) []string {
+	var names []string
+	for _, expr := range body {
+		defined := definedNames(expr)
+		if len(defined) == 0 {
+			break
+		}
+		names = append(names, defined...)
+	}
+	return names
+}
+
+// definedNames returns the names that the definition expr defines, or nil
+// if expr is not a definition.
+func definedNames(expr interface{}) []string {
+	lst, ok := expr.([]interface{})
+	if !ok || len(lst) < 2 {
+		return nil
+	}
+	switch {
+	case isKeyword(lst[0], "define"):
+		// the name may be in a header, which may be curried
+		target := lst[1]
+		for {
+			header, ok := target.([]interface{})
+			if !ok || len(header) == 0 {
+				break
+			}
+			target = header[0]
+		}
+		if name, ok := identifierName(target); ok {
+			return []string{name}
+		}
+	case isKeyword(lst[0], "define-values"):
+		if f, err := parseFormals("define-values", lst[1]); err == nil {
+			names := f.names
+			if f.rest != "" {
+				names = append(names[:len(names):len(names)], f.rest)
+			}
+			return names
+		}
+	case isKeyword(lst[0], "begin"):
+		// a begin of definitions splices them into the body
+		var names []string
+		for _, inner := range lst[1:] {
+			innerNames := definedNames(inner)
+			if innerNames == nil {
+				return nil
+			}
+			names = append(names, innerNames...)
+		}
+		return names
+	}
+	return nil
+}
+
+// apply calls the procedure f with args and returns its value. Unlike
+// applyThen, it runs the call to completion on the Go stack, so it is only
+// for code that must have the value to continue, like macro expansion.
+func apply(f interface{}, args []interface{}) (interface{}, error) {
+	return run(applyThen{f, args, nil})
+}
+
+// parseLiteral returns the value of a literal token.
+func parseLiteral(token string) (interface{}, error) {
+	if token[0] == '"' {
+		// string literal
+		return parseString(token)
+	} else if strings.HasPrefix(token, `#\`) {
+		// character literal
+		return parseChar(token)
+	} else if token == "#t" {
+		// true literal
+		return true, nil
+	} else if token == "#f" {
+		// false literal
+		return false, nil
+	} else if n, ok := parseNumber(token, 10); ok {
+		// number literal
+		return n, nil
+	} else {
+		return nil, fmt.Errorf("Eval: invalid literal '%s'", token)
 	}
 }
 
 func Exec(src string) (interface{}, error) {
 	// initialize execution environment
-	env := copyEnv(defaultEnv)
+	env := newGlobalEnv()
 
 	var err error
 
@@ -202,14 +530,11 @@ func Exec(src string) (interface{}, error) {
 		return nil, err
 	}
 
-	// evaluate expressions
-	var retval interface{}
-	for _, expr := range exprs {
-		retval, err = Eval(expr, env)
-		if err != nil {
-			return nil, err
-		}
+	// evaluate expressions in sequence, so that a continuation captured in
+	// one includes evaluating the rest
+	step, err := evalSequence(exprs, env)
+	if err != nil {
+		return nil, err
 	}
-
-	return retval, nil
+	return run(step)
 }
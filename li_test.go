@@ -3,6 +3,8 @@ package main
 import (
 	"container/list"
 	"fmt"
+	"io/ioutil"
+	"runtime/debug"
 	"testing"
 )
 
@@ -53,6 +55,87 @@ func TestLex(t *testing.T) {
 			t.Fatal("Lex failed: did not receive expected error")
 		}
 	}
+
+	{ // test string literals
+		src := `(string-append "a \"b\" ; c" "(d)")`
+		expected := []string{
+			"(", "string-append", " ", `"a \"b\" ; c"`, " ", `"(d)"`, ")",
+		}
+		actual, err := Lex(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stringSliceEquals(actual, expected) {
+			t.Log("expected: ", expected)
+			t.Log("actual: ", actual)
+			t.Fatal("Lex failed: expected != actual")
+		}
+	}
+
+	{ // test character literals
+		src := `(list #\a #\( #\space #\x41)`
+		expected := []string{
+			"(", "list", " ", `#\a`, " ", `#\(`, " ", `#\space`, " ", `#\x41`, ")",
+		}
+		actual, err := Lex(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stringSliceEquals(actual, expected) {
+			t.Log("expected: ", expected)
+			t.Log("actual: ", actual)
+			t.Fatal("Lex failed: expected != actual")
+		}
+	}
+
+	{ // test numerals
+		src := `(- 0 -5 +7 .5 -1/2 #xFF #e1.5 +inf.0 ->x)`
+		expected := []string{
+			"(", "-", " ", "0", " ", "-5", " ", "+7", " ", ".5", " ", "-1/2",
+			" ", "#xFF", " ", "#e1.5", " ", "+inf.0", " ", "->x", ")",
+		}
+		actual, err := Lex(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stringSliceEquals(actual, expected) {
+			t.Log("expected: ", expected)
+			t.Log("actual: ", actual)
+			t.Fatal("Lex failed: expected != actual")
+		}
+	}
+
+	{ // test parameter list marker
+		src := `(lambda (a #!optional b) a)`
+		expected := []string{
+			"(", "lambda", " ", "(", "a", " ", "#!optional", " ", "b", ")", " ", "a", ")",
+		}
+		actual, err := Lex(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stringSliceEquals(actual, expected) {
+			t.Log("expected: ", expected)
+			t.Log("actual: ", actual)
+			t.Fatal("Lex failed: expected != actual")
+		}
+	}
+
+	{ // test malformed numerals
+		for _, src := range []string{`(+ 1+ 2)`, `1.2.3`, `#b102`, `1/0`, `12abc`, `#x#d1`} {
+			_, err := Lex(src)
+			if err != ErrMalformedNumber {
+				t.Fatalf("Lex failed: did not receive expected error for %s", src)
+			}
+		}
+	}
+
+	{ // test incomplete string literal
+		_, err := Lex(`(display "abc`)
+		if err != ErrIncompleteString {
+			t.Fatal("Lex failed: did not receive expected error")
+		}
+	}
 }
 
 func TestPreprocess(t *testing.T) {
@@ -128,6 +211,54 @@ func TestParse(t *testing.T) {
 		}
 	}
 
+	{ // test stray closing paren
+		_, err := Parse([]string{")", "(", "+", "1", "2", ")"})
+		if err != ErrOvercompleteExpression {
+			t.Fatalf("Parse failed: did not receive expected error")
+		}
+	}
+
+	{ // test quote abbreviations
+		tokens := []string{"'", "x", "`", "(", "a", ",", "b", ",@", "c", ")"}
+		expected := []interface{}{
+			[]interface{}{"quote", "x"},
+			[]interface{}{"quasiquote", []interface{}{"a",
+				[]interface{}{"unquote", "b"},
+				[]interface{}{"unquote-splicing", "c"}}},
+		}
+		actual, err := Parse(tokens)
+		if err != nil {
+			t.Fatalf("Parse failed: received unexpected error")
+		}
+		if !sliceEquals(actual, expected) {
+			t.Log("expected: ", expected)
+			t.Log("actual: ", actual)
+			t.Fatalf("Parse failed: expected != actual")
+		}
+	}
+
+	{ // test vector literals
+		tokens := []string{"#(", "1", "(", "a", ")", "#(", ")", ")"}
+		actual, err := Parse(tokens)
+		if err != nil {
+			t.Fatalf("Parse failed: received unexpected error")
+		}
+		vec, ok := actual[0].(vectorLiteral)
+		if !ok || len(vec) != 3 || vec[0] != "1" {
+			t.Fatalf("Parse failed: expected a vector literal, got %v", actual[0])
+		}
+		if _, ok := vec[2].(vectorLiteral); !ok {
+			t.Fatalf("Parse failed: expected a nested vector literal, got %v", vec[2])
+		}
+	}
+
+	{ // test quote abbreviation without a datum
+		_, err := Parse([]string{"(", "a", "'", ")"})
+		if err != ErrMissingDatum {
+			t.Fatalf("Parse failed: did not receive expected error")
+		}
+	}
+
 	{ // test overcomplete tokens
 		tokens := []string{
 			"(", "+", "(", "*", "1", "(", "/", "1",
@@ -166,6 +297,359 @@ func TestExec(t *testing.T) {
 		`(define a (lambda () 1)) (a)`: 1,
 		`(remainder 33 7)`:             5,
 
+		`(define make-adder (lambda (n) (lambda (x) (+ x n))))
+(define add5 (make-adder 5))
+(define n 100)
+(add5 1)`: 6,
+		`(define x 1) (define f (lambda () x)) (define g (lambda (x) (f))) (g 2)`: 1,
+		`(define f (let ((y 10)) (lambda (x) (+ x y)))) (f 1)`:                    11,
+
+		`"abc"`:                                        str("abc"),
+		`"a\tb\x41;\\\""`:                              str("a\tbA\\\""),
+		`(string-length "héllo")`:                      5,
+		`(string-append "foo" "" "bar")`:               str("foobar"),
+		`(substring "hello" 1 3)`:                      str("el"),
+		`(substring "hello" 2)`:                        str("llo"),
+		`(string-ref "abc" 1)`:                         char('b'),
+		`(string=? "abc" "abc" "abc")`:                 true,
+		`(string<? "abc" "abd")`:                       true,
+		`(string->number "42")`:                        42,
+		`(string->number "ff" 16)`:                     255,
+		`(string->number "forty-two")`:                 false,
+		`(number->string 255 16)`:                      str("ff"),
+		`(string-upcase "Hello")`:                      str("HELLO"),
+		`(string-join (string-split "a,b,c" ",") "-")`: str("a-b-c"),
+		`(car (cdr (string-split "  one two  ")))`:     str("two"),
+
+		`#\a`:                             char('a'),
+		`#\space`:                         char(' '),
+		`#\x3bb`:                          char('λ'),
+		`(char? #\a)`:                     true,
+		`(char? "a")`:                     false,
+		`(char->integer #\A)`:             65,
+		`(integer->char 97)`:              char('a'),
+		`(char-alphabetic? #\z)`:          true,
+		`(char-numeric? #\7)`:             true,
+		`(char-whitespace? #\tab)`:        true,
+		`(char-upcase #\q)`:               char('Q'),
+		`(char<? #\a #\b #\c)`:            true,
+		`(char=? #\a (string-ref "a" 0))`: true,
+
+		`(/ 1 2.)`:                 0.5,
+		`(/ 12 4)`:                 3,
+		`(+ 1/3 2/3)`:              1,
+		`(* 1.5 2)`:                3.0,
+		`(- 10)`:                   -10,
+		`(exact->inexact 1/4)`:     0.25,
+		`(exact? 1/2)`:             true,
+		`(inexact? 1e3)`:           true,
+		`(< 1 3/2 2.0)`:            true,
+		`(= 1 1.0 2/2)`:            true,
+		`(round 7/2)`:              4,
+		`(floor -1/2)`:             -1,
+		`(string->number "2.5e2")`: 250.0,
+		`(number->string 0.5)`:     str("0.5"),
+
+		`(= 9007199254740993 9007199254740992.0)`: false,
+		`(< 9007199254740992.0 9007199254740993)`: true,
+		`(< 100000000000000000000000 +inf.0)`:     true,
+		`(> 1/3 (exact->inexact 1/3))`:            true,
+
+		`(- (+ 9223372036854775807 1) 1)`:                    9223372036854775807,
+		`(/ (* 4611686018427387904 4) 8)`:                    2305843009213693952,
+		`(> (* 4294967296 4294967296) 18446744073709551615)`: true,
+		`(quotient 17 5)`:                                    3,
+		`(remainder -7 2)`:                                   -1,
+		`(modulo -7 2)`:                                      1,
+		`(modulo 100000000000000000000 7)`:                   2,
+		`(exact? 100000000000000000000)`:                     true,
+		`(< 9223372036854775807 9223372036854775808 1e19)`:   true,
+
+		`0`:                        0,
+		`(+ 0 -5)`:                 -5,
+		`+7`:                       7,
+		`-.5`:                      -0.5,
+		`#xFF`:                     255,
+		`#x-1a`:                    -26,
+		`#b1010`:                   10,
+		`#o17`:                     15,
+		`#d10`:                     10,
+		`#e#x10`:                   16,
+		`#x#e10`:                   16,
+		`#i3`:                      3.0,
+		`(* 2 #e.5)`:               1,
+		`(string->number "#b101")`: 5,
+		`(string->number "777" 8)`: 511,
+		`(string->number "1+")`:    false,
+
+		`'a`:                        symbol("a"),
+		`(quote a)`:                 symbol("a"),
+		`(symbol? 'a)`:              true,
+		`(symbol? "a")`:             false,
+		`(car '(a b))`:              symbol("a"),
+		`(car (cdr '(1 "b")))`:      str("b"),
+		`(symbol->string 'abc)`:     str("abc"),
+		`(string->symbol "x")`:      symbol("x"),
+		"(car (cdr `(1 ,(+ 1 1))))": 2,
+
+		`(define (f) '(1 2)) (eq? (f) (f))`: true,
+		`(define (f) '#(1)) (eq? (f) (f))`:  true,
+		`(define (f) ''a) (eq? (f) (f))`:    true,
+
+		`(null? '())`:                  true,
+		`(null? 0)`:                    false,
+		`(null? (cons '() '()))`:       false,
+		`(pair? (cons 1 2))`:           true,
+		`(pair? '())`:                  false,
+		`(list? '(1 2))`:               true,
+		`(list? '(1 . 2))`:             false,
+		`(list? '())`:                  true,
+		`(length '(1 2 3))`:            3,
+		`(length '())`:                 0,
+		`(cdr (cons 1 2))`:             2,
+		`(car (list-tail '(1 2 3) 2))`: 3,
+
+		`(define x 1) (set! x 2) x`:                               2,
+		`(define x 1) (define f (lambda () (set! x 5))) (f) x`:    5,
+		`(define x 1) (define f (lambda (x) (set! x 5))) (f 0) x`: 1,
+		`(define p (cons 1 2)) (set-car! p 3) (car p)`:            3,
+		`(define p (list 1 2)) (set-cdr! p '()) (length p)`:       1,
+		`(define l (list 1 2)) (set-cdr! (cdr l) l) (list? l)`:    false,
+		`(define make-counter (lambda () (let ((n 0)) (lambda () (begin (set! n (+ n 1)) n)))))
+(define c (make-counter))
+(c)
+(c)`: 2,
+
+		`(vector-ref #(1 2 3) 1)`:           2,
+		`(vector-length (make-vector 5 0))`: 5,
+		`(vector? #())`:                     true,
+		`(vector? '(1))`:                    false,
+		`(define v (vector 1 2 3)) (vector-set! v 0 'a) (vector-ref v 0)`:         symbol("a"),
+		`(vector-ref (vector-map * #(1 2 3) #(4 5)) 1)`:                           10,
+		`(define n 0) (vector-for-each (lambda (x) (set! n (+ n x))) #(1 2 3)) n`: 6,
+
+		`(define t (make-hash-table)) (hash-table-set! t '(1 "a" #(2)) 3) (hash-table-ref t (list 1 "a" (vector 2)))`:             3,
+		`(define t (make-hash-table)) (hash-table-set! t 100000000000000000000 1) (hash-table-ref t (* 10000000000 10000000000))`: 1,
+		`(define t (make-hash-table eq?)) (define k (list 1)) (hash-table-set! t k 1) (hash-table-ref/default t (list 1) 2)`:      2,
+		`(define t (make-hash-table eq?)) (define k (list 1)) (hash-table-set! t k 1) (hash-table-ref t k)`:                       1,
+		`(hash-table-ref (make-hash-table) 'a (lambda () 'missing))`:                                                              symbol("missing"),
+		`(define t (make-hash-table)) (hash-table-set! t 'a 1) (hash-table-ref t 'a (lambda () 0) (lambda (v) (+ v 1)))`:          2,
+		`(define t (make-hash-table)) (hash-table-set! t 'a 1) (hash-table-delete! t 'a) (hash-table-contains? t 'a)`:             false,
+		`(define t (make-hash-table))
+(hash-table-update! t 'n (lambda (v) (+ v 1)) (lambda () 0))
+(hash-table-update! t 'n (lambda (v) (+ v 1)) (lambda () 0))
+(hash-table-ref t 'n)`: 2,
+		`(define t (make-hash-table))
+(hash-table-set! t 1 10)
+(hash-table-set! t 2 20)
+(define sum 0)
+(hash-table-walk t (lambda (k v) (set! sum (+ sum k v))))
+sum`: 33,
+		`(define t (make-hash-table)) (hash-table-set! t 1 10) (hash-table-set! t 2 20) (length (hash-table-keys t))`: 2,
+		`(define t (make-hash-table)) (hash-table-set! t 'k 'v) (cdr (car (hash-table->alist t)))`:                    symbol("v"),
+
+		`(define (f) 1) (eq? f f)`:                          true,
+		`(define (make) (lambda () 1)) (eq? (make) (make))`: false,
+		`(eq? macroexpand macroexpand-1)`:                   false,
+		`(eqv? if if)`:                                      true,
+		`(define t (make-hash-table eqv?)) (hash-table-set! t car 1) (hash-table-set! t cdr 2) (hash-table-ref t car)`: 1,
+
+		`(eq? 'a 'a)`:                         true,
+		`(eq? '() '())`:                       true,
+		`(eq? (list 1) (list 1))`:             false,
+		`(define l (list 1)) (eq? l l)`:       true,
+		`(eq? car car)`:                       true,
+		`(eq? (lambda (x) x) (lambda (x) x))`: false,
+		`(eqv? 1.5 1.5)`:                      true,
+		`(eqv? 1 1.0)`:                        false,
+		`(eqv? 100000000000000000000 100000000000000000000)`: true,
+		`(eqv? #\a #\a)`: true,
+		`(eqv? #f '())`:  false,
+		`(equal? '(1 (2 #(3)) "x") (list 1 (list 2 (vector 3)) "x"))`: true,
+		`(equal? '(1 2) '(1 2 3))`:                                    false,
+		`(equal? #(1 2) #(1 3))`:                                      false,
+		`(define a (list 1 2)) (set-cdr! (cdr a) a)
+(define b (list 1 2 1 2)) (set-cdr! (cdr (cdr (cdr b))) b)
+(equal? a b)`: true,
+		`(define a (list 1 2)) (set-cdr! (cdr a) a)
+(define b (list 1 3)) (set-cdr! (cdr b) b)
+(equal? a b)`: false,
+		`(memq 'z '(a b))`:                      false,
+		`(car (memv 2 '(1 2 3)))`:               2,
+		`(length (member "b" '("a" "b" "c")))`:  2,
+		`(car (member 2.0 '(1 2 3) =))`:         2,
+		`(cdr (assq 'b '((a . 1) (b . 2))))`:    2,
+		`(cdr (assv 2 '((1 . one) (2 . two))))`: symbol("two"),
+		`(cdr (assoc '(k) '(((k) . 3))))`:       3,
+		`(assoc "z" '(("a" . 1)))`:              false,
+
+		`(define-syntax swap! (syntax-rules () ((_ a b) (let ((tmp a)) (begin (set! a b) (set! b tmp))))))
+(define tmp 1)
+(define other 2)
+(swap! tmp other)
+(list tmp other)
+(- tmp other)`: 1,
+		`(define-syntax my-or (syntax-rules ()
+  ((_) #f)
+  ((_ e) e)
+  ((_ e r ...) (let ((t e)) (if t t (my-or r ...))))))
+(let ((t #t)) (my-or #f t))`: true,
+		`(define-syntax while (syntax-rules ()
+  ((_ c body ...) (begin (define loop (lambda () (if c (begin body ... (loop)) #f))) (loop)))))
+(define i 0)
+(define sum 0)
+(while (< i 5) (set! sum (+ sum i)) (set! i (+ i 1)))
+sum`: 10,
+		`(define-syntax unless (syntax-rules () ((_ c body ...) (if c #f (begin body ...)))))
+(unless (= 1 2) 'a 'b)`: symbol("b"),
+		`(define counter 0)
+(define-syntax inc! (syntax-rules () ((_) (set! counter (+ counter 1)))))
+(let ((counter 100)) (inc!))
+counter`: 1,
+		`(define-syntax my-if (syntax-rules (then else) ((_ c then a else b) (cond (c a) (else b)))))
+(my-if #f then 1 else 2)`: 2,
+		`(define-syntax lit (syntax-rules (k) ((_ k) 'literal) ((_ x) 'other)))
+(lit k)`: symbol("literal"),
+		`(define-syntax lit (syntax-rules (k) ((_ k) 'literal) ((_ x) 'other)))
+(let ((k 1)) (lit k))`: symbol("other"),
+		`(define k 1)
+(define-syntax lit (syntax-rules (k) ((_ k) 'literal) ((_ x) 'other)))
+(lit k)`: symbol("literal"),
+		`(define n 0)
+(define-macro (count-expansions) (set! n (+ n 1)) n)
+(define (f) (count-expansions))
+(f) (f) (f)
+n`: 1,
+		`(define-syntax my-or2 (syntax-rules () ((_ a b) (let ((x a)) (if x x b)))))
+(let ((if list)) (my-or2 #f #t))`: true,
+		`(define-syntax ten (syntax-rules () ((_) 10))) (ten)`:                                                  10,
+		`(define-syntax first (syntax-rules () ((_ #(a b ...)) a))) (first #(1 2 3))`:                           1,
+		`(let-syntax ((double (syntax-rules () ((_ x) (* x 2))))) (double 21))`:                                 42,
+		`(define-syntax my-begin (syntax-rules my-dots () ((_ e my-dots) (begin e my-dots)))) (my-begin 1 2 3)`: 3,
+		`(letrec-syntax ((my-and (syntax-rules ()
+    ((_) #t)
+    ((_ e) e)
+    ((_ e r ...) (if e (my-and r ...) #f)))))
+  (my-and #t #t #f))`: false,
+		`(define-syntax be-like-begin
+  (syntax-rules ()
+    ((_ name) (define-syntax name (syntax-rules () ((name expr (... ...)) (begin expr (... ...))))))))
+(be-like-begin sequence)
+(sequence 1 2 3)`: 3,
+
+		"(define-macro (my-unless c . body) `(if ,c #f (begin ,@body))) (my-unless #f 1 2)": 2,
+		`(define-macro (swap! a b) (list 'let (list (list 'tmp a)) (list 'begin (list 'set! a b) (list 'set! b 'tmp))))
+(define x 1)
+(define y 2)
+(swap! x y)
+(- x y)`: 1,
+		`(define-macro five (lambda () 5)) (five)`:                                              5,
+		`(define-macro (quote-args . args) (list 'quote args)) (length (quote-args a (b c) 1))`: 3,
+		`(define-macro (first-of x) (list car x)) (first-of '(9 8))`:                            9,
+
+		`(define-macro (m) 1) (eq? m m)`:                                                                      true,
+		`(define-macro (m) 1) (pair? (memq m (list m)))`:                                                      true,
+		`(define-macro (m) 1) (equal? (list m) (list m))`:                                                     true,
+		`(define-macro (m) 1) (define t (make-hash-table eqv?)) (hash-table-set! t m 1) (hash-table-ref t m)`: 1,
+		`(define-macro (m) (string->symbol "1")) (symbol? (m))`:                                               true,
+		`(define-macro (m) (list 'quote (list 'a (string->symbol ".") 'b))) (length (m))`:                     3,
+
+		`(+ 1 (call/cc (lambda (k) (+ 10 (k 2)))))`:           3,
+		`(call/cc (lambda (k) 5))`:                            5,
+		`(call-with-current-continuation (lambda (k) (k 4)))`: 4,
+		`(call/cc (lambda (break) (begin (vector-for-each (lambda (x) (if (> x 1) (break x) #f)) #(1 2 3)) 0)))`: 2,
+		`(define k #f)
+(define n 0)
+(+ 1 (call/cc (lambda (c) (begin (set! k c) 1))))
+(set! n (+ n 1))
+(if (< n 3) (k 1) n)`: 3,
+		`(define k #f)
+(define saved '())
+(define l (list 1 (call/cc (lambda (c) (begin (set! k c) 2))) 3))
+(if (null? saved) (begin (set! saved l) (k 5)) (+ (car (cdr saved)) (car (cdr l))))`: 7,
+		`(define r '())
+(define k #f)
+(set! r (cons (call/cc (lambda (c) (begin (set! k c) 0))) r))
+(if (< (length r) 3) (k (length r)) (car r))`: 2,
+		`(define k #f)
+(define saved '())
+(define (save c) (set! k c) 2)
+(define l (list 1 (call/cc save) 3))
+(if (null? saved) (begin (set! saved l) (k 5)) (+ (car (cdr saved)) (car (cdr l))))`: 7,
+		`(define (yes k) (k #t)) (if (call/cc yes) 1 2)`:                                              1,
+		`(define (h e) 41) (define (t) (raise-continuable 'oops)) (+ 1 (with-exception-handler h t))`: 42,
+
+		`(dynamic-wind (lambda () 1) (lambda () 2) (lambda () 3))`: 2,
+
+		`(guard (e (#t 42)) (raise 'oops))`:                                                                            42,
+		`(guard (e ((string? e) 1) (else 2)) (raise 'x))`:                                                              2,
+		`(guard (e (#t 0)) 1 2)`:                                                                                       2,
+		`(with-exception-handler (lambda (e) 10) (lambda () (+ 1 (raise-continuable 'c))))`:                            11,
+		`(call/cc (lambda (k) (with-exception-handler (lambda (e) (k e)) (lambda () (raise 5)))))`:                     5,
+		`(with-exception-handler (lambda (e) 7) (lambda () (+ 1 (guard (e ((string? e) 0)) (raise-continuable 'x)))))`: 8,
+
+		`(cond ((= 1 2) 1) ((= 1 1) 2 3))`: 3,
+		`(cond ((= 1 1)))`:                 true,
+		`(cond ((= 1 1) => not))`:          false,
+		`(cond ((= 1 2) 1) (else 2 3))`:    3,
+
+		`(call-with-values (lambda () (values 1 2)) +)`:   3,
+		`(call-with-values (lambda () 4) (lambda (x) x))`: 4,
+		`(values 5)`:                           5,
+		`(receive (q r) (values 7 2) (- q r))`: 5,
+		`(let-values (((a b) (values 1 2)) ((c) (values 3))) (+ a b c))`:         6,
+		`(define a 10) (let-values (((a) (values 1)) ((b) (values a))) b)`:       10,
+		`(let*-values (((a) (values 1)) ((b) (values a))) b)`:                    1,
+		`(define-values (x y) (values 1 2)) (+ x y)`:                             3,
+		`(call-with-values (lambda () (call/cc (lambda (k) (k 1 2)))) +)`:        3,
+		`(call-with-values (lambda () (truncate/ -7 2)) (lambda (q r) (* q r)))`: 3,
+		`(call-with-values (lambda () (floor/ -7 2)) (lambda (q r) (+ q r)))`:    -3,
+
+		`(let loop ((i 0)) (define j (+ i 1)) (if (= j 5) i (loop j)))`:           4,
+		`(let loop ((i 0)) (define (next) (+ i 1)) (if (= i 3) i (loop (next))))`: 3,
+
+		`(let loop ((i 0) (acc 0)) (if (> i 10) acc (loop (+ i 1) (+ acc i))))`: 55,
+		`(define x 10) (let ((x 1) (y x)) y)`:                                   10,
+		`(let ((x 1)) (set! x 5) x)`:                                            5,
+		`(let ((x 1)) (define y 2) (+ x y))`:                                    3,
+		`(let* ((x 1) (y (+ x 1))) (* x y))`:                                    2,
+		`(let* ((x 1) (x (+ x 1))) x)`:                                          2,
+		`(let* () 5)`:                                                           5,
+		`(letrec* ((a 1) (b (+ a 1))) b)`:                                       2,
+		`(letrec ((even? (lambda (n) (if (= n 0) #t (odd? (- n 1)))))
+         (odd? (lambda (n) (if (= n 0) #f (even? (- n 1))))))
+  (even? 100))`: true,
+
+		`((lambda (x) (define y (* x 2)) (+ x y)) 3)`:                      9,
+		`((lambda (x) (set! x (+ x 1)) (* x 2)) 4)`:                        10,
+		`(define x 1) (define f (lambda () (define x 2) x)) (+ (f) x)`:     3,
+		`(begin (define a 1) (define b 2)) (+ a b)`:                        3,
+		`((lambda () (begin (define a 1) (define b 2)) (+ a b)))`:          3,
+		`((lambda () (define-values (a b) (values 1 2)) (+ a b)))`:         3,
+		`(let () (define f (lambda () (g))) (define g (lambda () 7)) (f))`: 7,
+		`(define f (lambda (n)
+  (define even? (lambda (n) (if (= n 0) #t (odd? (- n 1)))))
+  (define odd? (lambda (n) (if (= n 0) #f (even? (- n 1)))))
+  (even? n)))
+(f 10)`: true,
+
+		`(define (square x) (* x x)) (square 5)`:                                  25,
+		`(define (f) 7) (f)`:                                                      7,
+		`(define (count . args) (length args)) (count 1 2 3)`:                     3,
+		`(define (f a b . rest) (+ a b (length rest))) (f 1 2 3 4)`:               5,
+		`(define ((adder n) x) (+ n x)) ((adder 3) 4)`:                            7,
+		`(define (((f a) b) c) (- a b c)) (((f 10) 3) 2)`:                         5,
+		`(define (f a #!optional b) (if (eq? b #f) a (+ a b))) (+ (f 1) (f 1 2))`: 4,
+		`(define (f a #!optional (b (* a 2))) (+ a b)) (+ (f 1) (f 1 1))`:         5,
+		`(define (f x) (define (g y) (* y 2)) (g x)) (f 4)`:                       8,
+		`(define (fact n) (if (= n 0) 1 (* n (fact (- n 1))))) (fact 10)`:         3628800,
+
+		`((lambda (a #!optional b . rest) (if b 0 (+ a (length rest)))) 1)`:          1,
+		`((case-lambda ((x) x) ((x y) (+ x y)) ((x . rest) (length rest))) 1)`:       1,
+		`((case-lambda ((x) x) ((x y) (+ x y)) ((x . rest) (length rest))) 1 2)`:     3,
+		`((case-lambda ((x) x) ((x y) (+ x y)) ((x . rest) (length rest))) 1 2 3 4)`: 3,
+		`(define f (case-lambda (() 0) ((a #!optional b) (list a b)))) (f)`:          0,
+
 		`
 ; Compute terms of the Fibonacci sequence.
 
@@ -228,6 +712,45 @@ func TestExec(t *testing.T) {
 
 (fast-prime? 999995 10) ; => false`: false,
 
+		`
+; Use Fermat's little theorem to develop a fast, probabilistic algorithm
+; for checking integer primality.
+
+; From "Structure and Interpretation of Computer Programs, Second Edition"
+; By Harold Abelson, Gerald Jay Sussman with Julie Sussman
+; Page 51
+; Section 1.2.6
+
+(define even?
+  (lambda (x) (= (remainder x 2) 0)))
+
+(define square
+  (lambda (x) (* x x)))
+
+(define expmod (lambda (base exp m)
+  (cond ((= exp 0) 1)
+        ((even? exp)
+         (remainder (square (expmod base (/ exp 2) m))
+                    m))
+        (else
+         (remainder (* base (expmod base (- exp 1) m))
+                    m)))))
+
+(define fermat-test (lambda (n)
+  (let 
+      ((try-it
+        (lambda (a) (= (expmod a n n) a))))
+    (try-it (+ 1 (random (- n 1)))))))
+
+(define fast-prime?
+  (lambda (n times)
+    (cond ((= times 0) #t)
+          ((fermat-test n) (fast-prime? n (- times 1)))
+          (else #f))))
+
+; 2^127 - 1 is a Mersenne prime
+(fast-prime? 170141183460469231731687303715884105727 10) ; => true`: true,
+
 		`
 ; Use Horner's rule and list accumulation to evaluate polynomials
 
@@ -268,6 +791,400 @@ func TestExec(t *testing.T) {
 	}
 }
 
+func TestExecErrors(t *testing.T) {
+	// each source must fail with an error rather than a panic
+	srcs := []string{
+		`(/ 1 0)`,
+		`(/ 1/2 0)`,
+		`(remainder 1 0)`,
+		`(quotient 100000000000000000000 0)`,
+		`(modulo 1 0)`,
+		`(random 0)`,
+		`(random -5)`,
+		`(define (f x))`,
+		`(define () 1)`,
+		`(define (f a #!optional b) a) (f 1 2 3)`,
+		`(define (f a . rest) a) (f)`,
+		`(define (f 1) 1)`,
+		`((lambda (a b) a) 1)`,
+		`((lambda (a #!optional b) a))`,
+		`((case-lambda ((a) a) ((a b) b)))`,
+		`(case-lambda (1 2))`,
+		`(case-lambda ((1) 2))`,
+		`(define 5 1)`,
+		`(define . 1)`,
+		`(define x 1) (set! . x)`,
+		`(let ((. 1)) 1)`,
+		`(let ((1 2)) 3)`,
+		`(lambda (1) 1)`,
+		`(if 1 2 3)`,
+		`(cond)`,
+		`(car 1)`,
+		`(+ 1 "a")`,
+		`(string-ref "abc" 3)`,
+		`(substring "abc" 2 1)`,
+		`(integer->char -1)`,
+		`(inexact->exact +inf.0)`,
+		`#\xd800`,
+		`"\q"`,
+		`(quote)`,
+		`'(1 . 2 3)`,
+		`,a`,
+		"`(1 ,@2)",
+		`(symbol->string "a")`,
+		`(length '(1 . 2))`,
+		`(append '(1 . 2) '(3))`,
+		`(reverse 1)`,
+		`(list-tail '(1 2) 3)`,
+		`(cdr '())`,
+		`(set! undefined 1)`,
+		`(set! 1 1)`,
+		`(set-car! '() 1)`,
+		`#(1 . 2)`,
+		`(vector-ref #(1 2) 2)`,
+		`(vector-set! #(1 2) -1 0)`,
+		`(make-vector -1)`,
+		`(make-vector 4611686018427387904)`,
+		`(make-vector 100000000000000000000)`,
+		`(vector-copy #(1 2) 2 1)`,
+		`(vector-map car #(1))`,
+		`(list->vector 1)`,
+		`(hash-table-ref (make-hash-table) 1)`,
+		`(substring "abc" 0 1 2)`,
+		`(make-vector)`,
+		`(vector-fill! #(1))`,
+		`(vector-map car)`,
+		`(make-hash-table equal? equal?)`,
+		`(hash-table-ref (make-hash-table))`,
+		`(memq 1 (list 1) eq?)`,
+		`(string-join)`,
+		`(hash-table-update! (make-hash-table) 1 car)`,
+		`(make-hash-table car)`,
+		`(hash-table-set! 1 2 3)`,
+		`(eq? 1)`,
+		`(memq 'a 'b)`,
+		`(assq 'a '(1))`,
+		`(define-syntax m (syntax-rules () ((_ a) a))) (m)`,
+		`(define-syntax m (syntax-rules () ((_ a ...) a))) (m 1)`,
+		`(define-syntax m 5)`,
+		`(syntax-rules)`,
+		`(define-syntax m (syntax-rules () ((_ x) (let ((y 1)) x)))) (m y)`,
+		`(define-macro (m 1) 1)`,
+		`(define-macro m 1)`,
+		`(define-macro (m a) a) (m)`,
+		`(call/cc 1)`,
+		`(dynamic-wind 1 2 3)`,
+		`(dynamic-wind (lambda () 1) (lambda () (car 1)) (lambda () 3))`,
+		`(raise 'oops)`,
+		`(error "bad thing" 1 2)`,
+		`(error 1)`,
+		`(with-exception-handler (lambda (e) 0) (lambda () (raise 'x)))`,
+		`(guard (e ((string? e) 0)) (raise 'x))`,
+		`(guard (e (else 1) (#t 2)) (raise 'x))`,
+		`(guard (e ((symbol? e) =>)) (raise 'x))`,
+		`(guard (e ((symbol? e) => car)) (raise 'x))`,
+		`(guard (e ((assq 'a e) => cdr)) (raise '((b . 1))))`,
+		`(guard (e ((memq e '(x y)))) (raise 'y))`,
+		`(cond (1 2))`,
+		`(cond ((= 1 1) =>))`,
+		`(error-object-message 1)`,
+		`(call-with-values (lambda () (values 1 2)) (lambda (x) x))`,
+		`(receive (a b) (values 1) a)`,
+		`(let-values (((a) (values 1 2))) a)`,
+		`(define-values (x y) 1)`,
+		`(receive (1) 1 1)`,
+		`(length (list (values)))`,
+		`(list (values 1 2))`,
+		`(car (list (values 1 2)))`,
+		`(equal? (values 1 2) (values 1 2))`,
+		`(eqv? (values 1 2) (values 1 2))`,
+		`(memv (values) (list (values)))`,
+		`(define t (make-hash-table)) (hash-table-set! t (values 1 2) 1)`,
+		`(define x (values 1 2))`,
+		`(define x 1) (set! x (values))`,
+		`(let ((x (values 1 2))) x)`,
+		`(let* ((x (values 1 2))) x)`,
+		`(letrec ((x (values 1 2))) x)`,
+		`(define (f #!optional (x (values 1 2))) x) (f)`,
+		"`(1 ,(values 2 3))",
+		`(vector-map (lambda (x) (values x x)) #(1))`,
+		`(define t (make-hash-table)) (hash-table-update! t 'k (lambda (v) (values v v)) (lambda () 0))`,
+		`(letrec ((a b) (b 1)) a)`,
+		`(letrec* ((a b) (b 1)) a)`,
+		`(let loop)`,
+		`(let loop ((x 1)) (loop))`,
+		`(let* ((x)) x)`,
+		`(let ((x 1)))`,
+		`(lambda (x))`,
+		`(define x 1) ((lambda () (define y x) (define x 2) y))`,
+		`(1 2)`,
+		`()`,
+		`undefined`,
+	}
+
+	for _, src := range srcs {
+		if _, err := Exec(src); err == nil {
+			t.Fatalf("Exec did not return an error for %s", src)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// without tail calls, each iteration below needs several Go stack frames,
+	// which overflows this limit long before the loops finish
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	srcTable := map[string]interface{}{
+		`(define loop (lambda (n) (if (= n 0) 0 (loop (- n 1))))) (loop 100000)`: 0,
+		`(define loop (lambda (n)
+  (cond ((= n 0) 0)
+        (else (begin 1 (loop (- n 1)))))))
+(loop 100000)`: 0,
+		`(define loop (lambda (n) (let ((m (- n 1))) (if (< m 0) n (loop m))))) (loop 100000)`: 0,
+		`(let loop ((n 100000)) (if (= n 0) 0 (loop (- n 1))))`:                                0,
+		`(define even? (lambda (n) (if (= n 0) #t (odd? (- n 1)))))
+(define odd? (lambda (n) (if (= n 0) #f (even? (- n 1)))))
+(even? 100001)`: false,
+	}
+
+	for k, v := range srcTable {
+		res, err := Exec(k)
+		if err != nil {
+			t.Fatalf(`Exec returned unexpected error: %v`, err)
+		}
+		if res != v {
+			t.Fatalf(`Exec
+	src: %s
+
+	expected: %v
+	got:      %v`, k, v, res)
+		}
+	}
+}
+
+func TestDeepRecursion(t *testing.T) {
+	// the evaluator keeps its own stack rather than recursing on the Go
+	// stack, so recursion deeper than this limit allows still succeeds
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	src := `(define count (lambda (n) (if (= n 0) 0 (+ 1 (count (- n 1)))))) (count 100000)`
+	res, err := Exec(src)
+	if err != nil {
+		t.Fatalf(`Exec returned unexpected error: %v`, err)
+	}
+	if res != 100000 {
+		t.Fatalf(`Exec
+	src: %s
+
+	expected: %v
+	got:      %v`, src, 100000, res)
+	}
+}
+
+func TestDynamicWindErrors(t *testing.T) {
+	// an error leaving the extent of dynamic-wind calls the after thunk
+	env := newGlobalEnv()
+	srcs := []string{
+		`(define trace '())`,
+		`(dynamic-wind (lambda () #f) (lambda () (car 1)) (lambda () (set! trace (cons 'after trace))))`,
+		`trace`,
+	}
+
+	var res interface{}
+	for i, src := range srcs {
+		tokens, err := Lex(src)
+		if err != nil {
+			t.Fatalf(`Lex returned unexpected error: %v`, err)
+		}
+		exprs, err := Parse(Preprocess(tokens))
+		if err != nil {
+			t.Fatalf(`Parse returned unexpected error: %v`, err)
+		}
+		res, err = Eval(exprs[0], env)
+		if (err != nil) != (i == 1) {
+			t.Fatalf(`Eval of %s returned error: %v`, src, err)
+		}
+	}
+	if writeString(res) != `(after)` {
+		t.Fatalf(`expected the after thunk to have run once, but trace is %s`, writeString(res))
+	}
+}
+
+func TestErrorIrritants(t *testing.T) {
+	// a circular irritant is written with datum labels
+	src := `(define p (list 1 2)) (set-cdr! (cdr p) p) (length p)`
+	expected := `Eval: procedure 'length' expected argument type 'list', but got '*main.pair' #0=(1 2 . #0#)`
+	_, err := Exec(src)
+	if err == nil || err.Error() != expected {
+		t.Fatalf(`Exec
+	src: %s
+
+	expected: %v
+	got:      %v`, src, expected, err)
+	}
+}
+
+func TestWriteString(t *testing.T) {
+	srcTable := map[string]string{
+		`42`:                      "42",
+		`#t`:                      "#t",
+		`"say \"hi\"\n"`:          `"say \"hi\"\n"`,
+		`(string-ref "abc" 0)`:    `#\a`,
+		`#\newline`:               `#\newline`,
+		`(list 1 "two" (list 3))`: `(1 "two" (3))`,
+		`(cons 1 2)`:              `(1 . 2)`,
+		`(define a 1)`:            `<nil>`,
+		`(lambda (x) x)`:          `#<procedure>`,
+		`(string-split "a b")`:    `("a" "b")`,
+		`(/ 1 3)`:                 `1/3`,
+		`(/ 6 -4)`:                `-3/2`,
+		`(inexact->exact 0.25)`:   `1/4`,
+		`(exact->inexact 1/3)`:    `0.3333333333333333`,
+		`(* 1.0 2)`:               `2.0`,
+		`1e21`:                    `1e+21`,
+		`(/ -1. 0)`:               `-inf.0`,
+
+		`(+ 9223372036854775807 1)`:      `9223372036854775808`,
+		`(- -9223372036854775807 2)`:     `-9223372036854775809`,
+		`123456789012345678901234567890`: `123456789012345678901234567890`,
+		`(/ 100000000000000000000 3)`:    `100000000000000000000/3`,
+		`#e1.5`:                          `3/2`,
+		`#i1/3`:                          `0.3333333333333333`,
+		`+inf.0`:                         `+inf.0`,
+
+		`'(a "b" #\c 1.5 (d))`:       `(a "b" #\c 1.5 (d))`,
+		`'(1 . 2)`:                   `(1 . 2)`,
+		`''a`:                        `(quote a)`,
+		"`(1 ,(+ 1 1) ,@(list 3 4))": `(1 2 3 4)`,
+		"`(a `(b ,(c ,(+ 1 2))))":    `(a (quasiquote (b (unquote (c 3)))))`,
+
+		`'()`:                           `()`,
+		`(list)`:                        `()`,
+		`'(1 2 . 3)`:                    `(1 2 . 3)`,
+		`(cons 1 (cons 2 '()))`:         `(1 2)`,
+		`(append '(1) '(2 3) '() '(4))`: `(1 2 3 4)`,
+		`(append '(1) 2)`:               `(1 . 2)`,
+		`(append)`:                      `()`,
+		`(reverse '(1 (2 3) 4))`:        `(4 (2 3) 1)`,
+		`(list-tail '(1 2 3) 1)`:        `(2 3)`,
+
+		`#(1 "a" #\b (c d) #(e))`:       `#(1 "a" #\b (c d) #(e))`,
+		`'#(a b)`:                       `#(a b)`,
+		`(make-vector 2 'x)`:            `#(x x)`,
+		`(vector->list #(1 2 3 4) 1 3)`: `(2 3)`,
+		`(list->vector '(1 2))`:         `#(1 2)`,
+		`(define v (vector 1 2 3 4)) (vector-fill! v 0 2) v`:                 `#(1 2 0 0)`,
+		`(vector-copy #(1 2 3) 1)`:                                           `#(2 3)`,
+		"`#(1 ,(+ 1 1) ,@(list 3 4))":                                        `#(1 2 3 4)`,
+		`(define v #(1 2)) (define w (vector-copy v)) (vector-set! w 0 9) v`: `#(1 2)`,
+
+		`(define-syntax rev (syntax-rules () ((_ (a b ...) ...) '((b ... a) ...)))) (rev (1 2 3) (4 5))`: `((2 3 1) (5 4))`,
+		`(define-syntax tail (syntax-rules () ((_ a . b) 'b))) (tail 1 2 3)`:                             `(2 3)`,
+		`(define-syntax m (syntax-rules () ((_ x) 'x))) (m (a "b" 1))`:                                   `(a "b" 1)`,
+
+		"(define-macro (my-unless c . body) `(if ,c #f (begin ,@body))) (macroexpand-1 '(my-unless (f) a b))": `(if (f) #f (begin a b))`,
+		"(define-macro (m x) `(n ,x)) (define-macro (n x) `(+ ,x 1)) (macroexpand '(m 2))":                    `(+ 2 1)`,
+		"(define-macro (m x) `(n ,x)) (define-macro (n x) `(+ ,x 1)) (macroexpand-1 '(m 2))":                  `(n 2)`,
+		`(define-syntax sr (syntax-rules () ((_ x) (if x 1 2)))) (macroexpand '(sr y))`:                       `(if y 1 2)`,
+		`(macroexpand '(+ 1 2))`: `(+ 1 2)`,
+
+		`(call/cc (lambda (k) k))`: `#<continuation>`,
+
+		`(define trace '())
+(define note (lambda (x) (set! trace (cons x trace))))
+(dynamic-wind (lambda () (note 'before)) (lambda () (note 'during)) (lambda () (note 'after)))
+(reverse trace)`: `(before during after)`,
+		`(define trace '())
+(define note (lambda (x) (set! trace (cons x trace))))
+(call/cc (lambda (k)
+  (dynamic-wind
+    (lambda () (note 'a-in))
+    (lambda () (dynamic-wind (lambda () (note 'b-in)) (lambda () (k 0)) (lambda () (note 'b-out))))
+    (lambda () (note 'a-out)))))
+(reverse trace)`: `(a-in b-in b-out a-out)`,
+		`(define trace '())
+(define note (lambda (x) (set! trace (cons x trace))))
+(define k #f)
+(dynamic-wind (lambda () (note 'in)) (lambda () (call/cc (lambda (c) (set! k c)))) (lambda () (note 'out)))
+(if (< (length trace) 4) (k 'again) (reverse trace))`: `(in out in out)`,
+		`(define trace '())
+(define note (lambda (x) (set! trace (cons x trace))))
+(define k #f)
+(dynamic-wind
+  (lambda () (note 'a-in))
+  (lambda () (call/cc (lambda (c) (set! k c))))
+  (lambda () (note 'a-out)))
+(dynamic-wind
+  (lambda () (note 'b-in))
+  (lambda () (if (< (length trace) 6) (k 'again) #f))
+  (lambda () (note 'b-out)))
+(reverse trace)`: `(a-in a-out b-in b-out a-in a-out b-in b-out)`,
+
+		`(guard (e ((symbol? e) (symbol->string e))) (raise 'oops))`:                       `"oops"`,
+		`(guard (e ((error-object? e) (error-object-message e))) (error "bad thing" 1 2))`: `"bad thing"`,
+		`(guard (e (#t (error-object-irritants e))) (error "bad" 1 "two"))`:                `(1 "two")`,
+		`(guard (e ((error-object? e) (error-object-irritants e))) (car 5))`:               `(5)`,
+		`(guard (e ((error-object? e) 'caught)) (car 1 2))`:                                `caught`,
+		`(guard (e (#t (list 'outer e))) (guard (e ((string? e) 'inner)) (raise 'x)))`:     `(outer x)`,
+		`(guard (e (#t e)) (error "bad"))`:                                                 `#<error-object>`,
+		`(define trace '())
+(define note (lambda (x) (set! trace (cons x trace))))
+(guard (e (#t (note 'handled)))
+  (dynamic-wind (lambda () (note 'in)) (lambda () (raise 'x)) (lambda () (note 'out))))
+(reverse trace)`: `(in out handled)`,
+
+		`(guard (e ((symbol? e) 1 2)) (raise 'x))`:                    `2`,
+		`(guard (e (else 'a 'b)) (raise 'x))`:                         `b`,
+		`(guard (e ((symbol? e) => list) ((string? e))) (raise 'x))`:  `(#t)`,
+		`(guard (e ((symbol? e) => list) ((string? e))) (raise "y"))`: `#t`,
+		`(guard (e ((pair? e) => not)) (raise '(1)))`:                 `#f`,
+
+		`(values 1 "two" '(3))`:                            `1 "two" (3)`,
+		`(begin (values 1 2))`:                             `1 2`,
+		`(call-with-values (lambda () (values)) list)`:     `()`,
+		`(receive (a . rest) (values 1 2 3) rest)`:         `(2 3)`,
+		`(receive all (values 1 2) all)`:                   `(1 2)`,
+		`(define-values (x . y) (values 1 2 3)) y`:         `(2 3)`,
+		`(vector-for-each (lambda (x) (values)) #(1))`:     `<nil>`,
+		`(call-with-values (lambda () (values 1 2)) list)`: `(1 2)`,
+
+		`((lambda args args) 1 2 3)`:                             `(1 2 3)`,
+		`((lambda args args))`:                                   `()`,
+		`((lambda (a . rest) rest) 1 2 3)`:                       `(2 3)`,
+		`((lambda (a #!optional (b a) . rest) (list b rest)) 1)`: `(1 ())`,
+		`(case-lambda ((x) x))`:                                  `#<procedure>`,
+
+		`(let ((p (list 1 2))) (set-cdr! (cdr p) p) p)`:                                     `#0=(1 2 . #0#)`,
+		`(let ((p (list 1 2))) (set-cdr! (cdr p) (cdr p)) p)`:                               `(1 . #0=(2 . #0#))`,
+		`(let ((p (list 1 2))) (set-car! p p) p)`:                                           `#0=(#0# 2)`,
+		`(let ((v (vector 1 2))) (vector-set! v 1 v) v)`:                                    `#0=#(1 #0#)`,
+		`(let ((v (vector 1)) (p (list 2))) (vector-set! v 0 p) (list v v))`:                `(#((2)) #((2)))`,
+		`(let ((v (vector 1)) (p (list 2))) (set-car! p v) (vector-set! v 0 p) (list p v))`: `(#0=(#(#0#)) #(#0#))`,
+
+		`
+(define square (lambda (x) (* x x)))
+(define expt (lambda (b n)
+  (cond ((= n 0) 1)
+        ((= (remainder n 2) 0) (square (expt b (/ n 2))))
+        (else (* b (expt b (- n 1)))))))
+(expt 3 100)`: `515377520732011331036461129765621272702107522001`,
+	}
+
+	for k, v := range srcTable {
+		res, err := Exec(k)
+		if err != nil {
+			t.Fatalf(`Exec returned unexpected error: %v`, err)
+		}
+		if writeString(res) != v {
+			t.Fatalf(`writeString
+	src: %s
+
+	expected: %s
+	got:      %s`, k, v, writeString(res))
+		}
+	}
+}
+
 func stringSliceEquals(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -371,3 +1288,15 @@ func listToString(l *list.List) string {
 		return res
 	}
 }
+
+func BenchmarkFib(b *testing.B) {
+	src, err := ioutil.ReadFile("examples/fib.scm")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		if _, err := Exec(string(src)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
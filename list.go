@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+)
+
+// A pair is a cons cell. Pairs are always handled through pointers, so that
+// each call to cons yields a distinct object.
+type pair struct {
+	car, cdr interface{}
+}
+
+// An emptyList is the empty list, (). All of its values are equal, and none
+// is a pair.
+type emptyList struct{}
+
+// listLength returns the number of elements in the proper list v, or false
+// if v is an improper or circular list.
+func listLength(v interface{}) (int, bool) {
+	// slow advances one pair for every two that v advances, so the two meet
+	// if the list is circular
+	slow := v
+	for n := 0; ; n++ {
+		if _, ok := v.(emptyList); ok {
+			return n, true
+		}
+		p, ok := v.(*pair)
+		if !ok {
+			return 0, false
+		}
+		v = p.cdr
+		if n%2 == 1 {
+			slow = slow.(*pair).cdr
+			if slow == v {
+				return 0, false
+			}
+		}
+	}
+}
+
+var listEnv = map[string]interface{}{
+	"set-car!": &proc{
+		[]string{"p", "a"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			if p, ok := env.vars["p"].(*pair); ok {
+				p.car = env.vars["a"]
+				return nil, nil
+			} else {
+				return nil, createTypeError("set-car!", "pair", env.vars["p"])
+			}
+		},
+		nil,
+	},
+
+	"set-cdr!": &proc{
+		[]string{"p", "a"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			if p, ok := env.vars["p"].(*pair); ok {
+				p.cdr = env.vars["a"]
+				return nil, nil
+			} else {
+				return nil, createTypeError("set-cdr!", "pair", env.vars["p"])
+			}
+		},
+		nil,
+	},
+
+	"pair?": &proc{
+		[]string{"a"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			_, ok := env.vars["a"].(*pair)
+			return ok, nil
+		},
+		nil,
+	},
+
+	"list?": &proc{
+		[]string{"a"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			_, ok := listLength(env.vars["a"])
+			return ok, nil
+		},
+		nil,
+	},
+
+	"length": &proc{
+		[]string{"l"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if n, ok := listLength(env.vars["l"]); ok {
+				return n, nil
+			} else {
+				return nil, createTypeError("length", "list", env.vars["l"])
+			}
+		},
+		nil,
+	},
+
+	// (append list ... obj) copies each list but the last, which becomes the
+	// tail of the result and need not be a list
+	"append": &proc{
+		[]string{"lists"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			args := env.vars["lists"].([]interface{})
+			if len(args) == 0 {
+				return emptyList{}, nil
+			}
+			elements := []interface{}{}
+			for _, arg := range args[:len(args)-1] {
+				l, ok := listToSlice(arg)
+				if !ok {
+					return nil, createTypeError("append", "list", arg)
+				}
+				elements = append(elements, l...)
+			}
+			return sliceToDottedList(elements, args[len(args)-1]), nil
+		},
+		nil,
+	},
+
+	"reverse": &proc{
+		[]string{"l"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			elements, ok := listToSlice(env.vars["l"])
+			if !ok {
+				return nil, createTypeError("reverse", "list", env.vars["l"])
+			}
+			var result interface{} = emptyList{}
+			for _, element := range elements {
+				result = &pair{element, result}
+			}
+			return result, nil
+		},
+		nil,
+	},
+
+	// (list-tail l k) returns l without its first k elements
+	"list-tail": &proc{
+		[]string{"l", "k"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			k, ok := env.vars["k"].(int)
+			if !ok {
+				return nil, createTypeError("list-tail", "int", env.vars["k"])
+			}
+			if k < 0 {
+				return nil, fmt.Errorf("Eval: procedure 'list-tail' expected a non-negative index, but got %d", k)
+			}
+			l := env.vars["l"]
+			for i := 0; i < k; i++ {
+				p, ok := l.(*pair)
+				if !ok {
+					return nil, fmt.Errorf("Eval: procedure 'list-tail' index %d out of range for length %d", k, i)
+				}
+				l = p.cdr
+			}
+			return l, nil
+		},
+		nil,
+	},
+}
+
+func init() {
+	for name, v := range listEnv {
+		defaultEnv[name] = v
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+)
+
+// A procMacro is a define-macro transformer: an ordinary procedure that is
+// called with the unevaluated arguments of a macro use, as data, and
+// returns the code to evaluate in its place. Unlike syntax-rules macros,
+// procMacros are not hygienic.
+type procMacro struct {
+	proc interface{}
+}
+
+func (m *procMacro) transform(form []interface{}, env *Env) (interface{}, error) {
+	elements, tail, err := splitDottedList(form[1:])
+	if err != nil {
+		return nil, err
+	}
+	if tail != nil {
+		return nil, fmt.Errorf("Eval: macro use '%s' must be a proper list", writeExpr(form))
+	}
+	args := make([]interface{}, len(elements))
+	for i := range elements {
+		if args[i], err = datum(elements[i]); err != nil {
+			return nil, err
+		}
+	}
+	v, err := apply(m.proc, args)
+	if err != nil {
+		return nil, err
+	}
+	return datumToExpr(v), nil
+}
+
+// datumToExpr returns the code that the datum v denotes, the inverse of
+// datum: symbols become identifiers and lists become expressions. Other
+// values are left in place, and evaluate to themselves, as do symbols whose
+// names would read as something other than an identifier, such as 1.
+func datumToExpr(v interface{}) interface{} {
+	switch v := v.(type) {
+	case symbol:
+		if v == "" || !isIdentifier(string(v)) {
+			return v
+		}
+		return string(v)
+	case emptyList:
+		return []interface{}{}
+	case *pair:
+		expr := []interface{}{}
+		var tail interface{} = v
+		for {
+			p, ok := tail.(*pair)
+			if !ok {
+				break
+			}
+			expr = append(expr, datumToExpr(p.car))
+			tail = p.cdr
+		}
+		if _, ok := tail.(emptyList); !ok {
+			expr = append(expr, ".", datumToExpr(tail))
+		}
+		return expr
+	case *vector:
+		expr := make(vectorLiteral, len(v.elements))
+		for i, element := range v.elements {
+			expr[i] = datumToExpr(element)
+		}
+		return expr
+	default:
+		return v
+	}
+}
+
+// expandOnce expands expr if it is a macro use, reporting whether it was.
+func expandOnce(expr interface{}, env *Env) (interface{}, bool, error) {
+	form, ok := expr.([]interface{})
+	if !ok || len(form) == 0 {
+		return expr, false, nil
+	}
+	var v interface{}
+	switch op := form[0].(type) {
+	case string:
+		if !isIdentifier(op) {
+			return expr, false, nil
+		}
+		v, ok = env.Lookup(op)
+	case *alias:
+		name, bindingEnv := resolve(op, env)
+		v, ok = bindingEnv.Lookup(name)
+	default:
+		return expr, false, nil
+	}
+	t, isTransformer := v.(transformer)
+	if !ok || !isTransformer {
+		return expr, false, nil
+	}
+	expansion, err := t.transform(form, env)
+	return expansion, err == nil, err
+}
+
+// createMacroexpandForm returns a special form that evaluates its argument
+// to a form, as data, and expands it once, or repeatedly until it is no
+// longer a macro use if all is true.
+func createMacroexpandForm(name string, all bool) *specialForm {
+	return &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, createArgLenError(name, 1, args)
+		}
+		return evalThen{args[0], env, func(form interface{}) (interface{}, error) {
+			expr := datumToExpr(form)
+			for {
+				expansion, expanded, err := expandOnce(expr, env)
+				if err != nil {
+					return nil, err
+				}
+				if !expanded {
+					break
+				}
+				expr = expansion
+				if !all {
+					break
+				}
+			}
+			return datum(expr)
+		}}, nil
+	}}
+}
+
+var macroEnv = map[string]interface{}{
+	// (define-macro (name . params) body ...) or (define-macro name proc)
+	// modifies given env
+	"define-macro": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("Eval: procedure 'define-macro' expected at least 2 arguments, but got %d arguments", len(args))
+		}
+		var name string
+		var f interface{}
+		if header, ok := args[0].([]interface{}); ok && len(header) > 0 {
+			if name, ok = identifierName(header[0]); !ok {
+				return nil, createNameError("define-macro", header[0])
+			}
+			var err error
+			if f, err = createLambda("define-macro", header[1:], args[1:], env); err != nil {
+				return nil, err
+			}
+		} else {
+			if name, ok = identifierName(args[0]); !ok {
+				return nil, createNameError("define-macro", args[0])
+			}
+			if len(args) != 2 {
+				return nil, createArgLenError("define-macro", 2, args)
+			}
+			return evalThen{args[1], env, func(f interface{}) (interface{}, error) {
+				if _, ok := f.(*proc); !ok {
+					return nil, fmt.Errorf("Eval: procedure 'define-macro' expected a procedure, but got '%s'", writeString(f))
+				}
+				env.Define(name, &procMacro{f})
+				return nil, nil
+			}}, nil
+		}
+		env.Define(name, &procMacro{f})
+		return nil, nil
+	}},
+
+	// (macroexpand-1 form) expands form once if it is a macro use
+	"macroexpand-1": createMacroexpandForm("macroexpand-1", false),
+
+	// (macroexpand form) expands form until it is no longer a macro use
+	"macroexpand": createMacroexpandForm("macroexpand", true),
+}
+
+func init() {
+	for name, v := range macroEnv {
+		defaultEnv[name] = v
+	}
+}
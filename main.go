@@ -51,7 +51,7 @@ func readStdin() {
 	}
 
 	// print evaluated src
-	fmt.Println(expr)
+	fmt.Println(writeString(expr))
 	os.Exit(0)
 }
 
@@ -60,7 +60,7 @@ func repl() {
 	tokensc := make(chan string)
 	exprsc := make(chan interface{})
 	rd := bufio.NewReader(os.Stdin)
-	env := copyEnv(defaultEnv)
+	env := newGlobalEnv()
 
 	// read stdin
 	go func() {
@@ -81,8 +81,15 @@ func repl() {
 
 	// lex
 	go func() {
+		pending := ""
 		for line := range linesc {
-			tokens, err := Lex(line)
+			tokens, err := Lex(pending + line)
+			if err == ErrIncompleteString {
+				// string literal continues on the next line
+				pending += line
+				continue
+			}
+			pending = ""
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
@@ -123,7 +130,7 @@ func repl() {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
-		fmt.Println(">>>", v)
+		fmt.Println(">>>", writeString(v))
 	}
 
 	os.Exit(0)
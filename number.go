@@ -0,0 +1,776 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Numbers are represented by four Go types, in increasing order of
+// generality: int for exact integers, *big.Int for exact integers too large
+// for an int, *big.Rat for exact non-integer rationals, and float64 for
+// inexact reals. Arithmetic converts its operands to the most general type
+// among them, and exact results are normalized to the least general type
+// that can hold them, so an integer that fits in an int is always an int.
+
+const (
+	rankInt = iota
+	rankBig
+	rankRat
+	rankFloat
+)
+
+// numRank returns the position of v's type in the tower, or -1 if v is not a
+// number.
+func numRank(v interface{}) int {
+	switch v.(type) {
+	case int:
+		return rankInt
+	case *big.Int:
+		return rankBig
+	case *big.Rat:
+		return rankRat
+	case float64:
+		return rankFloat
+	default:
+		return -1
+	}
+}
+
+func isNumber(v interface{}) bool {
+	return numRank(v) >= 0
+}
+
+func isExact(v interface{}) bool {
+	rank := numRank(v)
+	return rank >= 0 && rank != rankFloat
+}
+
+func isExactInteger(v interface{}) bool {
+	return numRank(v) == rankInt || numRank(v) == rankBig
+}
+
+// normalizeBig returns x as an int if it fits in one.
+func normalizeBig(x *big.Int) interface{} {
+	if x.IsInt64() {
+		if i := x.Int64(); int64(int(i)) == i {
+			return int(i)
+		}
+	}
+	return x
+}
+
+// normalizeRat returns r as an int or *big.Int if it is integral.
+func normalizeRat(r *big.Rat) interface{} {
+	if r.IsInt() {
+		return normalizeBig(new(big.Int).Set(r.Num()))
+	}
+	return r
+}
+
+func toBig(v interface{}) *big.Int {
+	switch v := v.(type) {
+	case int:
+		return big.NewInt(int64(v))
+	case *big.Int:
+		return v
+	default:
+		panic(fmt.Sprintf("toBig: not an exact integer: %T", v))
+	}
+}
+
+func toRat(v interface{}) *big.Rat {
+	switch v := v.(type) {
+	case int:
+		return new(big.Rat).SetInt64(int64(v))
+	case *big.Int:
+		return new(big.Rat).SetInt(v)
+	case *big.Rat:
+		return v
+	default:
+		panic(fmt.Sprintf("toRat: not an exact number: %T", v))
+	}
+}
+
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	default:
+		panic(fmt.Sprintf("toFloat: not a number: %T", v))
+	}
+}
+
+// maxRank returns the rank both a and b must be converted to in order to
+// combine them.
+func maxRank(a, b interface{}) int {
+	if ra, rb := numRank(a), numRank(b); ra > rb {
+		return ra
+	} else {
+		return rb
+	}
+}
+
+// The int cases of numAdd, numSub and numMul check for overflow and redo the
+// operation with big.Int if it occurs.
+
+func numAdd(a, b interface{}) interface{} {
+	switch maxRank(a, b) {
+	case rankInt:
+		x, y := a.(int), b.(int)
+		if z := x + y; (z > x) == (y > 0) {
+			return z
+		}
+		return new(big.Int).Add(toBig(a), toBig(b))
+	case rankBig:
+		return normalizeBig(new(big.Int).Add(toBig(a), toBig(b)))
+	case rankRat:
+		return normalizeRat(new(big.Rat).Add(toRat(a), toRat(b)))
+	default:
+		return toFloat(a) + toFloat(b)
+	}
+}
+
+func numSub(a, b interface{}) interface{} {
+	switch maxRank(a, b) {
+	case rankInt:
+		x, y := a.(int), b.(int)
+		if z := x - y; (z < x) == (y > 0) {
+			return z
+		}
+		return new(big.Int).Sub(toBig(a), toBig(b))
+	case rankBig:
+		return normalizeBig(new(big.Int).Sub(toBig(a), toBig(b)))
+	case rankRat:
+		return normalizeRat(new(big.Rat).Sub(toRat(a), toRat(b)))
+	default:
+		return toFloat(a) - toFloat(b)
+	}
+}
+
+func numMul(a, b interface{}) interface{} {
+	switch maxRank(a, b) {
+	case rankInt:
+		x, y := a.(int), b.(int)
+		if x == 0 || y == 0 {
+			return 0
+		}
+		if z := x * y; z/y == x && !(x == -1 && y == math.MinInt) && !(y == -1 && x == math.MinInt) {
+			return z
+		}
+		return new(big.Int).Mul(toBig(a), toBig(b))
+	case rankBig:
+		return normalizeBig(new(big.Int).Mul(toBig(a), toBig(b)))
+	case rankRat:
+		return normalizeRat(new(big.Rat).Mul(toRat(a), toRat(b)))
+	default:
+		return toFloat(a) * toFloat(b)
+	}
+}
+
+// numDiv divides exactly if both a and b are exact, so (/ 1 2) is 1/2.
+func numDiv(a, b interface{}) (interface{}, error) {
+	if maxRank(a, b) == rankFloat {
+		return toFloat(a) / toFloat(b), nil
+	}
+	if toRat(b).Sign() == 0 {
+		return nil, fmt.Errorf("Eval: procedure '/' division by zero")
+	}
+	return normalizeRat(new(big.Rat).Quo(toRat(a), toRat(b))), nil
+}
+
+// numCompare returns -1, 0 or 1 as a is less than, equal to or greater than
+// b. Neither may be NaN.
+func numCompare(a, b interface{}) int {
+	switch maxRank(a, b) {
+	case rankInt:
+		x, y := a.(int), b.(int)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case rankBig:
+		return toBig(a).Cmp(toBig(b))
+	case rankFloat:
+		fa, aInexact := a.(float64)
+		fb, bInexact := b.(float64)
+		if aInexact && bInexact {
+			if fa < fb {
+				return -1
+			} else if fa > fb {
+				return 1
+			}
+			return 0
+		}
+		// compare an exact number with a finite float exactly, not as
+		// floats, so that comparisons are transitive
+		if aInexact && math.IsInf(fa, 0) {
+			return int(math.Copysign(1, fa))
+		}
+		if bInexact && math.IsInf(fb, 0) {
+			return -int(math.Copysign(1, fb))
+		}
+		if aInexact {
+			return new(big.Rat).SetFloat64(fa).Cmp(toRat(b))
+		}
+		return toRat(a).Cmp(new(big.Rat).SetFloat64(fb))
+	default:
+		return toRat(a).Cmp(toRat(b))
+	}
+}
+
+func isNaN(v interface{}) bool {
+	f, ok := v.(float64)
+	return ok && math.IsNaN(f)
+}
+
+func toExact(name string, v interface{}) (interface{}, error) {
+	f, ok := v.(float64)
+	if !ok {
+		return v, nil
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("Eval: procedure '%s' cannot convert %s to an exact number", name, writeString(f))
+	}
+	return normalizeRat(new(big.Rat).SetFloat64(f)), nil
+}
+
+var decimalPattern = regexp.MustCompile(`^(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// parseNumber reads a numeral in the given default radix. The numeral may
+// begin with radix (#b, #o, #d, #x) and exactness (#e, #i) prefixes in
+// either order, followed by an optional sign and an integer, a rational
+// such as 1/3, or, in radix 10, a decimal such as 1.5e3. Integers of any
+// length are accepted. +inf.0, -inf.0 and +nan.0 denote the special reals.
+func parseNumber(s string, radix int) (interface{}, bool) {
+	// most numerals are small decimal integers
+	if n, err := strconv.Atoi(s); err == nil && radix == 10 {
+		return n, true
+	}
+	radixSet := false
+	exactness := byte(0)
+	for len(s) >= 2 && s[0] == '#' {
+		switch p := s[1] | 0x20; p { // lower case
+		case 'b', 'o', 'd', 'x':
+			if radixSet {
+				return nil, false
+			}
+			radixSet = true
+			radix = map[byte]int{'b': 2, 'o': 8, 'd': 10, 'x': 16}[p]
+		case 'e', 'i':
+			if exactness != 0 {
+				return nil, false
+			}
+			exactness = p
+		default:
+			return nil, false
+		}
+		s = s[2:]
+	}
+
+	n, ok := parseReal(s, radix, exactness == 'e')
+	if !ok {
+		return nil, false
+	}
+	if exactness == 'i' {
+		return toFloat(n), true
+	}
+	return n, true
+}
+
+// parseReal reads an optionally signed numeral without prefixes. Decimals are
+// read exactly if exact is set.
+func parseReal(s string, radix int, exact bool) (interface{}, bool) {
+	switch strings.ToLower(s) {
+	case "+inf.0":
+		return math.Inf(1), !exact
+	case "-inf.0":
+		return math.Inf(-1), !exact
+	case "+nan.0", "-nan.0":
+		return math.NaN(), !exact
+	}
+
+	sign, digits := "", s
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		sign, digits = s[:1], s[1:]
+	}
+
+	if i := strings.IndexByte(digits, '/'); i >= 0 {
+		num, ok := parseUinteger(sign+digits[:i], radix)
+		if !ok {
+			return nil, false
+		}
+		den, ok := parseUinteger(digits[i+1:], radix)
+		if !ok || den.Sign() == 0 {
+			return nil, false
+		}
+		return normalizeRat(new(big.Rat).SetFrac(num, den)), true
+	}
+
+	if n, ok := parseUinteger(sign+digits, radix); ok {
+		return normalizeBig(n), true
+	}
+
+	if radix != 10 || !decimalPattern.MatchString(digits) {
+		return nil, false
+	}
+	if exact {
+		r, ok := new(big.Rat).SetString(sign + digits)
+		if !ok {
+			return nil, false
+		}
+		return normalizeRat(r), true
+	}
+	f, err := strconv.ParseFloat(sign+digits, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return nil, false
+	}
+	return f, true
+}
+
+// parseUinteger reads an integer of one or more digits in radix, with an
+// optional sign.
+func parseUinteger(s string, radix int) (*big.Int, bool) {
+	digits := strings.TrimLeft(s, "+-")
+	if len(s)-len(digits) > 1 || len(digits) == 0 {
+		return nil, false
+	}
+	for _, c := range strings.ToLower(digits) {
+		d := strings.IndexRune("0123456789abcdef", c)
+		if d < 0 || d >= radix {
+			return nil, false
+		}
+	}
+	return new(big.Int).SetString(s, radix)
+}
+
+// writeNumber returns the external representation of the number v. Inexact
+// integers keep a decimal point so that they read back as inexact.
+func writeNumber(v interface{}) string {
+	switch v := v.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case *big.Int:
+		return v.String()
+	case *big.Rat:
+		return v.RatString()
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "+nan.0"
+		case math.IsInf(v, 1):
+			return "+inf.0"
+		case math.IsInf(v, -1):
+			return "-inf.0"
+		}
+		format := byte('f')
+		if abs := math.Abs(v); abs != 0 && (abs >= 1e21 || abs < 1e-7) {
+			format = 'g'
+		}
+		s := strconv.FormatFloat(v, format, -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	default:
+		panic(fmt.Sprintf("writeNumber: not a number: %T", v))
+	}
+}
+
+// checkNumbers returns a type error for the first argument that is not a
+// number.
+func checkNumbers(name string, args []interface{}) error {
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return createTypeError(name, "number", arg)
+		}
+	}
+	return nil
+}
+
+// createNumCompareProc returns a procedure that checks that each pair of
+// adjacent arguments satisfies test, given the result of numCompare.
+func createNumCompareProc(name string, test func(c int) bool) *proc {
+	return &proc{
+		[]string{"nums"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			nums := env.vars["nums"].([]interface{})
+			if len(nums) == 0 {
+				return nil, fmt.Errorf("Eval: procedure '%s' expected at least 1 argument, got 0", name)
+			}
+			if err := checkNumbers(name, nums); err != nil {
+				return nil, err
+			}
+			result := true
+			for i := 0; i+1 < len(nums); i++ {
+				if isNaN(nums[i]) || isNaN(nums[i+1]) || !test(numCompare(nums[i], nums[i+1])) {
+					result = false
+				}
+			}
+			return result, nil
+		},
+		nil,
+	}
+}
+
+// ratFloor returns the largest integer not greater than x.
+func ratFloor(x *big.Rat) *big.Int {
+	// big.Int.Div rounds towards negative infinity for positive divisors,
+	// and the denominator of a big.Rat is always positive
+	return new(big.Int).Div(x.Num(), x.Denom())
+}
+
+func ratCeiling(x *big.Rat) *big.Int {
+	return new(big.Int).Neg(ratFloor(new(big.Rat).Neg(x)))
+}
+
+func ratTruncate(x *big.Rat) *big.Int {
+	if x.Sign() < 0 {
+		return ratCeiling(x)
+	}
+	return ratFloor(x)
+}
+
+// ratRound returns the integer closest to x, rounding to even on ties.
+func ratRound(x *big.Rat) *big.Int {
+	floor := ratFloor(x)
+	diff := new(big.Rat).Sub(x, new(big.Rat).SetInt(floor))
+	switch diff.Cmp(big.NewRat(1, 2)) {
+	case -1:
+		return floor
+	case 1:
+		return floor.Add(floor, big.NewInt(1))
+	default:
+		if floor.Bit(0) == 1 {
+			return floor.Add(floor, big.NewInt(1))
+		}
+		return floor
+	}
+}
+
+// createRoundingProc returns a procedure that rounds a number to an integer,
+// keeping its exactness.
+func createRoundingProc(name string, roundFloat func(f float64) float64, roundRat func(x *big.Rat) *big.Int) *proc {
+	return &proc{
+		[]string{"x"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			switch x := env.vars["x"].(type) {
+			case int, *big.Int:
+				return x, nil
+			case *big.Rat:
+				return normalizeRat(new(big.Rat).SetInt(roundRat(x))), nil
+			case float64:
+				return roundFloat(x), nil
+			default:
+				return nil, createTypeError(name, "number", x)
+			}
+		},
+		nil,
+	}
+}
+
+// createIntegerDivProc returns a procedure that divides two exact integers
+// with intOp, or bigOp if either does not fit in an int.
+func createIntegerDivProc(name string, intOp func(a, b int) int, bigOp func(a, b *big.Int) *big.Int) *proc {
+	return &proc{
+		[]string{"a", "b"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			a, b := env.vars["a"], env.vars["b"]
+			if !isExactInteger(a) {
+				return nil, createTypeError(name, "integer", a)
+			}
+			if !isExactInteger(b) {
+				return nil, createTypeError(name, "integer", b)
+			}
+			if b == 0 {
+				return nil, fmt.Errorf("Eval: procedure '%s' division by zero", name)
+			}
+			if maxRank(a, b) == rankInt && !(a == math.MinInt && b == -1) {
+				return intOp(a.(int), b.(int)), nil
+			}
+			return normalizeBig(bigOp(toBig(a), toBig(b))), nil
+		},
+		nil,
+	}
+}
+
+// createNumPredicate returns a procedure that tests whether its argument is
+// a number satisfying test.
+func createNumPredicate(test func(v interface{}) bool) *proc {
+	return &proc{
+		[]string{"a"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			a := env.vars["a"]
+			return isNumber(a) && test(a), nil
+		},
+		nil,
+	}
+}
+
+var numberEnv = map[string]interface{}{
+	"+": &proc{
+		[]string{"nums"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			nums := env.vars["nums"].([]interface{})
+			if err := checkNumbers("+", nums); err != nil {
+				return nil, err
+			}
+			var result interface{} = 0
+			for _, num := range nums {
+				result = numAdd(result, num)
+			}
+			return result, nil
+		},
+		nil,
+	},
+
+	"*": &proc{
+		[]string{"nums"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			nums := env.vars["nums"].([]interface{})
+			if err := checkNumbers("*", nums); err != nil {
+				return nil, err
+			}
+			var result interface{} = 1
+			for _, num := range nums {
+				result = numMul(result, num)
+			}
+			return result, nil
+		},
+		nil,
+	},
+
+	// (- x) negates x; (- x y ...) subtracts each y from x
+	"-": &proc{
+		[]string{"nums"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			nums := env.vars["nums"].([]interface{})
+			if len(nums) == 0 {
+				return nil, fmt.Errorf("Eval: procedure '-' expected at least 1 argument, got 0")
+			}
+			if err := checkNumbers("-", nums); err != nil {
+				return nil, err
+			}
+			if len(nums) == 1 {
+				return numSub(0, nums[0]), nil
+			}
+			result := nums[0]
+			for _, num := range nums[1:] {
+				result = numSub(result, num)
+			}
+			return result, nil
+		},
+		nil,
+	},
+
+	// (/ x) is the reciprocal of x; (/ x y ...) divides x by each y
+	"/": &proc{
+		[]string{"nums"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			nums := env.vars["nums"].([]interface{})
+			if len(nums) == 0 {
+				return nil, fmt.Errorf("Eval: procedure '/' expected at least 1 argument, got 0")
+			}
+			if err := checkNumbers("/", nums); err != nil {
+				return nil, err
+			}
+			if len(nums) == 1 {
+				return numDiv(1, nums[0])
+			}
+			result := nums[0]
+			for _, num := range nums[1:] {
+				var err error
+				if result, err = numDiv(result, num); err != nil {
+					return nil, err
+				}
+			}
+			return result, nil
+		},
+		nil,
+	},
+
+	"=":  createNumCompareProc("=", func(c int) bool { return c == 0 }),
+	"<":  createNumCompareProc("<", func(c int) bool { return c < 0 }),
+	">":  createNumCompareProc(">", func(c int) bool { return c > 0 }),
+	"<=": createNumCompareProc("<=", func(c int) bool { return c <= 0 }),
+	">=": createNumCompareProc(">=", func(c int) bool { return c >= 0 }),
+
+	"number?":   createNumPredicate(func(v interface{}) bool { return true }),
+	"real?":     createNumPredicate(func(v interface{}) bool { return true }),
+	"exact?":    createNumPredicate(isExact),
+	"inexact?":  createNumPredicate(func(v interface{}) bool { return !isExact(v) }),
+	"rational?": createNumPredicate(func(v interface{}) bool { return isExact(v) || !math.IsInf(toFloat(v), 0) && !isNaN(v) }),
+	"integer?": createNumPredicate(func(v interface{}) bool {
+		if f, ok := v.(float64); ok {
+			return f == math.Trunc(f) && !math.IsInf(f, 0)
+		}
+		return isExactInteger(v)
+	}),
+
+	"exact->inexact": &proc{
+		[]string{"z"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if z := env.vars["z"]; isNumber(z) {
+				return toFloat(z), nil
+			} else {
+				return nil, createTypeError("exact->inexact", "number", z)
+			}
+		},
+		nil,
+	},
+
+	"inexact->exact": &proc{
+		[]string{"z"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if z := env.vars["z"]; isNumber(z) {
+				return toExact("inexact->exact", z)
+			} else {
+				return nil, createTypeError("inexact->exact", "number", z)
+			}
+		},
+		nil,
+	},
+
+	"numerator": &proc{
+		[]string{"q"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			q := env.vars["q"]
+			if !isNumber(q) {
+				return nil, createTypeError("numerator", "number", q)
+			}
+			exact, err := toExact("numerator", q)
+			if err != nil {
+				return nil, err
+			}
+			n := normalizeRat(new(big.Rat).SetInt(toRat(exact).Num()))
+			if !isExact(q) {
+				return toFloat(n), nil
+			}
+			return n, nil
+		},
+		nil,
+	},
+
+	"denominator": &proc{
+		[]string{"q"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			q := env.vars["q"]
+			if !isNumber(q) {
+				return nil, createTypeError("denominator", "number", q)
+			}
+			exact, err := toExact("denominator", q)
+			if err != nil {
+				return nil, err
+			}
+			d := normalizeRat(new(big.Rat).SetInt(toRat(exact).Denom()))
+			if !isExact(q) {
+				return toFloat(d), nil
+			}
+			return d, nil
+		},
+		nil,
+	},
+
+	"quotient": createIntegerDivProc("quotient",
+		func(a, b int) int { return a / b },
+		func(a, b *big.Int) *big.Int { return new(big.Int).Quo(a, b) }),
+	"remainder": createIntegerDivProc("remainder",
+		func(a, b int) int { return a % b },
+		func(a, b *big.Int) *big.Int { return new(big.Int).Rem(a, b) }),
+	"modulo": createIntegerDivProc("modulo",
+		func(a, b int) int {
+			if m := a % b; m != 0 && (m < 0) != (b < 0) {
+				return m + b
+			} else {
+				return m
+			}
+		},
+		func(a, b *big.Int) *big.Int {
+			// big.Int.Mod is always non-negative; modulo takes the sign of b
+			m := new(big.Int).Mod(a, b)
+			if m.Sign() != 0 && b.Sign() < 0 {
+				m.Add(m, b)
+			}
+			return m
+		}),
+
+	"abs": &proc{
+		[]string{"x"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			x := env.vars["x"]
+			if !isNumber(x) {
+				return nil, createTypeError("abs", "number", x)
+			}
+			if !isNaN(x) && numCompare(x, 0) < 0 {
+				return numSub(0, x), nil
+			}
+			return x, nil
+		},
+		nil,
+	},
+
+	"gcd": &proc{
+		[]string{"nums"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			result := new(big.Int)
+			for _, num := range env.vars["nums"].([]interface{}) {
+				if !isExactInteger(num) {
+					return nil, createTypeError("gcd", "integer", num)
+				}
+				result.GCD(nil, nil, result, new(big.Int).Abs(toBig(num)))
+			}
+			return normalizeBig(result), nil
+		},
+		nil,
+	},
+
+	"exact-integer?": &proc{
+		[]string{"a"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			return isExactInteger(env.vars["a"]), nil
+		},
+		nil,
+	},
+
+	"floor":    createRoundingProc("floor", math.Floor, ratFloor),
+	"ceiling":  createRoundingProc("ceiling", math.Ceil, ratCeiling),
+	"truncate": createRoundingProc("truncate", math.Trunc, ratTruncate),
+	"round":    createRoundingProc("round", math.RoundToEven, ratRound),
+}
+
+func init() {
+	numberEnv["exact"] = numberEnv["inexact->exact"]
+	numberEnv["inexact"] = numberEnv["exact->inexact"]
+	for name, v := range numberEnv {
+		defaultEnv[name] = v
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// writeString returns the external representation of v, as printed by the
+// REPL: strings are quoted and escaped so that they read back as the same
+// value, and a pair or vector that contains itself is written with datum
+// labels, as #0=(1 . #0#).
+func writeString(v interface{}) string {
+	w := writer{}
+	switch v.(type) {
+	case *pair, *vector:
+		w.findCycles(v, map[interface{}]bool{}, map[interface{}]bool{})
+	}
+	return w.write(v)
+}
+
+// A writer writes the external representation of a datum. labels holds the
+// pairs and vectors met again inside themselves, with the datum label of each
+// once it has been written, or -1 before.
+type writer struct {
+	labels map[interface{}]int
+	next   int
+}
+
+// findCycles adds to w.labels each pair or vector reachable from v that is
+// reachable from itself. onPath holds the objects v is inside of, and done
+// those already searched.
+func (w *writer) findCycles(v interface{}, onPath, done map[interface{}]bool) {
+	walked := []interface{}{}
+	for {
+		switch v.(type) {
+		case *pair, *vector:
+		default:
+			v = nil
+		}
+		if v == nil || done[v] {
+			break
+		}
+		if onPath[v] {
+			if w.labels == nil {
+				w.labels = map[interface{}]int{}
+			}
+			w.labels[v] = -1
+			break
+		}
+		onPath[v] = true
+		walked = append(walked, v)
+		if vec, ok := v.(*vector); ok {
+			for _, element := range vec.elements {
+				w.findCycles(element, onPath, done)
+			}
+			break
+		}
+		// the cdrs of a list are followed here rather than by recursion, so
+		// that a long list does not need a deep stack
+		p := v.(*pair)
+		w.findCycles(p.car, onPath, done)
+		v = p.cdr
+	}
+	for _, v := range walked {
+		delete(onPath, v)
+		done[v] = true
+	}
+}
+
+// label returns the prefix to write before v: #n= the first time a labelled
+// object is met, and otherwise "". ok is false when v has already been
+// written, in which case prefix is the reference #n# to write in its place.
+func (w *writer) label(v interface{}) (prefix string, ok bool) {
+	n, labelled := w.labels[v]
+	if !labelled {
+		return "", true
+	}
+	if n >= 0 {
+		return fmt.Sprintf("#%d#", n), false
+	}
+	n = w.next
+	w.next++
+	w.labels[v] = n
+	return fmt.Sprintf("#%d=", n), true
+}
+
+func (w *writer) write(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "<nil>"
+	case bool:
+		if v {
+			return "#t"
+		}
+		return "#f"
+	case int, *big.Rat, float64:
+		return writeNumber(v)
+	case str:
+		return quoteString(string(v))
+	case char:
+		return writeChar(v)
+	case symbol:
+		return string(v)
+	case emptyList:
+		return "()"
+	case *pair:
+		prefix, ok := w.label(v)
+		if !ok {
+			return prefix
+		}
+		strs := []string{}
+		var tail interface{} = v
+		for {
+			p, ok := tail.(*pair)
+			if !ok {
+				break
+			}
+			if _, labelled := w.labels[p]; labelled && len(strs) > 0 {
+				// a labelled pair within the list is written as the tail
+				break
+			}
+			strs = append(strs, w.write(p.car))
+			tail = p.cdr
+		}
+		if _, ok := tail.(emptyList); !ok {
+			strs = append(strs, ".", w.write(tail))
+		}
+		return prefix + "(" + strings.Join(strs, " ") + ")"
+	case *vector:
+		prefix, ok := w.label(v)
+		if !ok {
+			return prefix
+		}
+		strs := make([]string, len(v.elements))
+		for i, element := range v.elements {
+			strs[i] = w.write(element)
+		}
+		return prefix + "#(" + strings.Join(strs, " ") + ")"
+	case *hashTable:
+		return "#<hash-table>"
+	case *proc:
+		return "#<procedure>"
+	case continuation:
+		return "#<continuation>"
+	case *errorObject:
+		return "#<error-object>"
+	case multipleValues:
+		return writeValues(v)
+	case *specialForm:
+		return "#<special form>"
+	case transformer:
+		return "#<macro>"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// quoteString returns s as a string literal.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < ' ' || r == 0x7f {
+				fmt.Fprintf(&b, `\x%x;`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -1,13 +1,98 @@
 package main
 
-type specialForm func(args []interface{}, env map[string]interface{}) (interface{}, error)
+import (
+	"fmt"
+)
 
-type variadicProc struct {
-	param string
-	body  func(env map[string]interface{}) (interface{}, error)
+// A specialForm is given the unevaluated arguments of a form, and the
+// environment to evaluate them in. Special forms and procedures are used by
+// pointer, so that each is an object of its own for eqv.
+type specialForm struct {
+	body func(args []interface{}, env *Env) (interface{}, error)
 }
 
+// A tailCall is returned by special forms and procedure bodies in place of a
+// value, asking Eval to continue by evaluating expr in env.
+type tailCall struct {
+	expr interface{}
+	env  *Env
+}
+
+// An arity describes the numbers of arguments that a procedure accepts: the
+// required arguments, then up to optional more, then any number more if rest
+// is true.
+type arity struct {
+	required, optional int
+	rest               bool
+}
+
+// accepts reports whether a procedure of arity a accepts n arguments.
+func (a arity) accepts(n int) bool {
+	return n >= a.required && (a.rest || n <= a.required+a.optional)
+}
+
+func (a arity) String() string {
+	switch {
+	case a.rest:
+		return fmt.Sprintf("at least %d", a.required)
+	case a.optional == 0:
+		return fmt.Sprint(a.required)
+	default:
+		return fmt.Sprintf("%d to %d", a.required, a.required+a.optional)
+	}
+}
+
+// A proc binds its arguments to the names in params: the required and
+// optional arguments to the corresponding names, leaving the names of
+// optional arguments that were not given unbound, and if arity.rest is true,
+// the remaining arguments, as a slice, to the last name. env is the
+// environment the procedure was created in, or nil for builtins.
 type proc struct {
 	params []string
-	body   func(env map[string]interface{}) (interface{}, error)
+	arity  arity
+	body   func(env *Env) (interface{}, error)
+	env    *Env
+}
+
+// optionalArgs returns the values of the optional parameters names of a
+// builtin, in order, up to the first that the call left unbound.
+func optionalArgs(env *Env, names ...string) []interface{} {
+	args := []interface{}{}
+	for _, name := range names {
+		v, ok := env.vars[name]
+		if !ok {
+			break
+		}
+		args = append(args, v)
+	}
+	return args
+}
+
+// An evalThen is returned by special forms and procedure bodies that need
+// the value of a subexpression. It asks the evaluator to evaluate expr in
+// env, then continue by calling then with the value. then returns a value or
+// another step, as a special form does. The evaluator keeps then on a stack
+// of its own, so that a continuation may resume it any number of times: then
+// must not change the variables it closes over.
+type evalThen struct {
+	expr interface{}
+	env  *Env
+	then func(v interface{}) (interface{}, error)
+}
+
+// An applyThen asks the evaluator to call the procedure f with args, then
+// continue by calling then with the result. If then is nil, the call is a
+// tail call.
+type applyThen struct {
+	f    interface{}
+	args []interface{}
+	then func(v interface{}) (interface{}, error)
+}
+
+// A stepThen asks the evaluator to perform step, then continue by calling
+// then with its value. It is for a step that a builtin procedure called in
+// place returned.
+type stepThen struct {
+	step interface{}
+	then func(v interface{}) (interface{}, error)
 }
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+)
+
+// A symbol is a Scheme symbol, the value of a quoted identifier. It is
+// distinct from the Go strings the parser uses for identifiers in code.
+type symbol string
+
+var errDottedVector = fmt.Errorf("Eval: '.' is not allowed in a vector literal")
+
+// A quoted is the datum of a quote expression, which the expression keeps in
+// place of the quoted expression once it has been converted, so that each
+// evaluation returns the same object.
+type quoted struct {
+	expr, value interface{}
+}
+
+// datum returns the value denoted by expr when it is quoted: identifiers
+// become symbols, literals their values and lists lists of data.
+func datum(expr interface{}) (interface{}, error) {
+	switch expr := expr.(type) {
+	case *quoted:
+		return datum(expr.expr)
+	case *expanded:
+		return datum(expr.keyword)
+	case string:
+		if !isIdentifier(expr) {
+			return parseLiteral(expr)
+		}
+		return symbol(expr), nil
+	case *alias:
+		return symbol(baseName(expr)), nil
+	case []interface{}:
+		elements, tail, err := splitDottedList(expr)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]interface{}, len(elements))
+		for i := range elements {
+			if data[i], err = datum(elements[i]); err != nil {
+				return nil, err
+			}
+		}
+		var tailDatum interface{} = emptyList{}
+		if tail != nil {
+			if tailDatum, err = datum(tail); err != nil {
+				return nil, err
+			}
+		}
+		return sliceToDottedList(data, tailDatum), nil
+	case vectorLiteral:
+		elements := make([]interface{}, len(expr))
+		for i := range expr {
+			if expr[i] == "." {
+				return nil, errDottedVector
+			}
+			var err error
+			if elements[i], err = datum(expr[i]); err != nil {
+				return nil, err
+			}
+		}
+		return &vector{elements}, nil
+	default:
+		return expr, nil
+	}
+}
+
+// splitDottedList separates a list expression of the form (a b . c) into its
+// elements and tail, c. tail is nil if expr is a proper list.
+func splitDottedList(expr []interface{}) ([]interface{}, interface{}, error) {
+	for i, e := range expr {
+		if e != "." {
+			continue
+		}
+		if i == 0 || i != len(expr)-2 {
+			return nil, nil, fmt.Errorf("Eval: '.' must come before the last element of a list")
+		}
+		return expr[:i], expr[i+1], nil
+	}
+	return expr, nil, nil
+}
+
+// sliceToDottedList returns a list of the given elements ending in tail
+// instead of the empty list.
+func sliceToDottedList(elements []interface{}, tail interface{}) interface{} {
+	result := tail
+	for i := len(elements) - 1; i >= 0; i-- {
+		result = &pair{elements[i], result}
+	}
+	return result
+}
+
+// isForm reports whether expr is a list of length n beginning with the
+// identifier name.
+func isForm(expr interface{}, name string, n int) bool {
+	lst, ok := expr.([]interface{})
+	return ok && len(lst) == n && isKeyword(lst[0], name)
+}
+
+// quasiquote fills in the quasiquoted template expr, evaluating the unquoted
+// expressions at nesting depth 1 in env, and continues by calling then with
+// the value.
+func quasiquote(expr interface{}, depth int, env *Env, then func(v interface{}) (interface{}, error)) (interface{}, error) {
+	if vec, ok := expr.(vectorLiteral); ok {
+		// a vector template is filled in as a list, then converted
+		return quasiquote([]interface{}(vec), depth, env, func(l interface{}) (interface{}, error) {
+			elements, ok := listToSlice(l)
+			if !ok {
+				return nil, errDottedVector
+			}
+			return then(&vector{elements})
+		})
+	}
+	lst, ok := expr.([]interface{})
+	if !ok {
+		v, err := datum(expr)
+		if err != nil {
+			return nil, err
+		}
+		return then(v)
+	}
+
+	if isForm(lst, "unquote", 2) {
+		if depth == 1 {
+			return evalThen{lst[1], env, func(v interface{}) (interface{}, error) {
+				if err := singleValue("unquote", v); err != nil {
+					return nil, err
+				}
+				return then(v)
+			}}, nil
+		}
+		return quasiquote(lst[1], depth-1, env, func(inner interface{}) (interface{}, error) {
+			return then(sliceToList([]interface{}{symbol("unquote"), inner}))
+		})
+	}
+	if isForm(lst, "quasiquote", 2) {
+		return quasiquote(lst[1], depth+1, env, func(inner interface{}) (interface{}, error) {
+			return then(sliceToList([]interface{}{symbol("quasiquote"), inner}))
+		})
+	}
+
+	elements, tail, err := splitDottedList(lst)
+	if err != nil {
+		return nil, err
+	}
+	return quasiquoteList(elements, tail, depth, env, []interface{}{}, then)
+}
+
+// quasiquoteList fills in the elements of a list template and its dotted
+// tail, if not nil, appending the values to done. done is copied rather than
+// appended to in place, as the evaluation of an unquoted expression may
+// return more than once.
+func quasiquoteList(elements []interface{}, tail interface{}, depth int, env *Env, done []interface{}, then func(v interface{}) (interface{}, error)) (interface{}, error) {
+	if len(elements) == 0 {
+		if tail == nil {
+			return then(sliceToList(done))
+		}
+		return quasiquote(tail, depth, env, func(tailValue interface{}) (interface{}, error) {
+			return then(sliceToDottedList(done, tailValue))
+		})
+	}
+	element := elements[0]
+	next := func(values ...interface{}) (interface{}, error) {
+		return quasiquoteList(elements[1:], tail, depth, env, append(done[:len(done):len(done)], values...), then)
+	}
+	if isForm(element, "unquote-splicing", 2) && depth == 1 {
+		return evalThen{element.([]interface{})[1], env, func(v interface{}) (interface{}, error) {
+			spliced, ok := listToSlice(v)
+			if !ok {
+				return nil, fmt.Errorf("Eval: unquote-splicing expected a list, but got '%s'", writeString(v))
+			}
+			return next(spliced...)
+		}}, nil
+	}
+	if isForm(element, "unquote-splicing", 2) {
+		return quasiquote(element.([]interface{})[1], depth-1, env, func(inner interface{}) (interface{}, error) {
+			return next(sliceToList([]interface{}{symbol("unquote-splicing"), inner}))
+		})
+	}
+	return quasiquote(element, depth, env, func(v interface{}) (interface{}, error) {
+		return next(v)
+	})
+}
+
+var quoteEnv = map[string]interface{}{
+	"quote": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, createArgLenError("quote", 1, args)
+		}
+		if q, ok := args[0].(*quoted); ok {
+			return q.value, nil
+		}
+		v, err := datum(args[0])
+		if err != nil {
+			return nil, err
+		}
+		args[0] = &quoted{args[0], v}
+		return v, nil
+	}},
+
+	"quasiquote": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, createArgLenError("quasiquote", 1, args)
+		}
+		return quasiquote(args[0], 1, env, func(v interface{}) (interface{}, error) {
+			return v, nil
+		})
+	}},
+
+	"unquote": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		return nil, fmt.Errorf("Eval: unquote is only valid inside quasiquote")
+	}},
+
+	"unquote-splicing": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		return nil, fmt.Errorf("Eval: unquote-splicing is only valid inside quasiquote")
+	}},
+
+	"symbol?": &proc{
+		[]string{"a"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			_, ok := env.vars["a"].(symbol)
+			return ok, nil
+		},
+		nil,
+	},
+
+	"symbol->string": &proc{
+		[]string{"s"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if s, ok := env.vars["s"].(symbol); ok {
+				return str(s), nil
+			} else {
+				return nil, createTypeError("symbol->string", "symbol", env.vars["s"])
+			}
+		},
+		nil,
+	},
+
+	"string->symbol": &proc{
+		[]string{"s"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if s, ok := env.vars["s"].(str); ok {
+				return symbol(s), nil
+			} else {
+				return nil, createTypeError("string->symbol", "string", env.vars["s"])
+			}
+		},
+		nil,
+	},
+}
+
+func init() {
+	for name, v := range quoteEnv {
+		defaultEnv[name] = v
+	}
+}
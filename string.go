@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A str is a Scheme string. It is distinct from the Go strings the parser
+// uses for identifiers and literal tokens.
+type str string
+
+// parseString decodes a string literal token, including its double quotes,
+// into a str, interpreting the R7RS escape sequences.
+func parseString(token string) (interface{}, error) {
+	src := []rune(token[1 : len(token)-1])
+	var b strings.Builder
+	for i := 0; i < len(src); i++ {
+		if src[i] != '\\' {
+			b.WriteRune(src[i])
+			continue
+		}
+		i++
+		switch src[i] {
+		case 'a':
+			b.WriteRune('\a')
+		case 'b':
+			b.WriteRune('\b')
+		case 't':
+			b.WriteRune('\t')
+		case 'n':
+			b.WriteRune('\n')
+		case 'r':
+			b.WriteRune('\r')
+		case '"', '\\', '|':
+			b.WriteRune(src[i])
+		case 'x', 'X':
+			// hex scalar value terminated by a semicolon
+			end := i + 1
+			for end < len(src) && src[end] != ';' {
+				end++
+			}
+			if end == len(src) {
+				return nil, fmt.Errorf("Eval: unterminated hex escape in string literal %s", token)
+			}
+			n, err := strconv.ParseUint(string(src[i+1:end]), 16, 32)
+			if err != nil || !isScalarValue(int(n)) {
+				return nil, fmt.Errorf("Eval: invalid hex escape '\\%s;' in string literal", string(src[i:end]))
+			}
+			b.WriteRune(rune(n))
+			i = end
+		case ' ', '\t', '\n', '\r':
+			// line continuation: skip trailing whitespace, one line
+			// ending and the next line's leading whitespace
+			for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+				i++
+			}
+			if i < len(src) && src[i] == '\r' {
+				i++
+			}
+			if i >= len(src) || src[i] != '\n' {
+				return nil, fmt.Errorf("Eval: invalid line continuation in string literal %s", token)
+			}
+			for i+1 < len(src) && (src[i+1] == ' ' || src[i+1] == '\t') {
+				i++
+			}
+		default:
+			return nil, fmt.Errorf("Eval: unknown escape sequence '\\%c' in string literal", src[i])
+		}
+	}
+	return str(b.String()), nil
+}
+
+// createStringCompareProc returns a procedure that checks that each pair of
+// adjacent string arguments satisfies cmp.
+func createStringCompareProc(name string, cmp func(a, b string) bool) *proc {
+	return &proc{
+		[]string{"strings"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			args := env.vars["strings"].([]interface{})
+			if len(args) == 0 {
+				return nil, fmt.Errorf("Eval: procedure '%s' expected at least 1 argument, got 0", name)
+			}
+			for _, arg := range args {
+				if _, ok := arg.(str); !ok {
+					return nil, createTypeError(name, "string", arg)
+				}
+			}
+			for i := 0; i+1 < len(args); i++ {
+				if !cmp(string(args[i].(str)), string(args[i+1].(str))) {
+					return false, nil
+				}
+			}
+			return true, nil
+		},
+		nil,
+	}
+}
+
+// checkIndex returns k as an index into a sequence of length n, where
+// inclusive allows k == n, as for the end of a substring.
+func checkIndex(name string, k interface{}, n int, inclusive bool) (int, error) {
+	i, ok := k.(int)
+	if !ok {
+		return 0, createTypeError(name, "int", k)
+	}
+	if i < 0 || i > n || (i == n && !inclusive) {
+		return 0, fmt.Errorf("Eval: procedure '%s' index %d out of range for length %d", name, i, n)
+	}
+	return i, nil
+}
+
+var stringEnv = map[string]interface{}{
+	"string?": &proc{
+		[]string{"a"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			_, ok := env.vars["a"].(str)
+			return ok, nil
+		},
+		nil,
+	},
+
+	"string-length": &proc{
+		[]string{"s"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if s, ok := env.vars["s"].(str); ok {
+				return len([]rune(string(s))), nil
+			} else {
+				return nil, createTypeError("string-length", "string", env.vars["s"])
+			}
+		},
+		nil,
+	},
+
+	"string-append": &proc{
+		[]string{"strings"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			var b strings.Builder
+			for _, arg := range env.vars["strings"].([]interface{}) {
+				if s, ok := arg.(str); ok {
+					b.WriteString(string(s))
+				} else {
+					return nil, createTypeError("string-append", "string", arg)
+				}
+			}
+			return str(b.String()), nil
+		},
+		nil,
+	},
+
+	// (substring s start [end])
+	"substring": &proc{
+		[]string{"s", "start", "end"},
+		arity{2, 1, false},
+		func(env *Env) (interface{}, error) {
+			s, ok := env.vars["s"].(str)
+			if !ok {
+				return nil, createTypeError("substring", "string", env.vars["s"])
+			}
+			runes := []rune(string(s))
+			start, end, err := checkRange("substring", optionalArgs(env, "start", "end"), len(runes))
+			if err != nil {
+				return nil, err
+			}
+			return str(runes[start:end]), nil
+		},
+		nil,
+	},
+
+	"string-ref": &proc{
+		[]string{"s", "k"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			s, ok := env.vars["s"].(str)
+			if !ok {
+				return nil, createTypeError("string-ref", "string", env.vars["s"])
+			}
+			runes := []rune(string(s))
+			k, err := checkIndex("string-ref", env.vars["k"], len(runes), false)
+			if err != nil {
+				return nil, err
+			}
+			return char(runes[k]), nil
+		},
+		nil,
+	},
+
+	"string=?":  createStringCompareProc("string=?", func(a, b string) bool { return a == b }),
+	"string<?":  createStringCompareProc("string<?", func(a, b string) bool { return a < b }),
+	"string>?":  createStringCompareProc("string>?", func(a, b string) bool { return a > b }),
+	"string<=?": createStringCompareProc("string<=?", func(a, b string) bool { return a <= b }),
+	"string>=?": createStringCompareProc("string>=?", func(a, b string) bool { return a >= b }),
+
+	// (string->number s [radix]) returns #f if s is not a number
+	"string->number": &proc{
+		[]string{"s", "radix"},
+		arity{1, 1, false},
+		func(env *Env) (interface{}, error) {
+			s, ok := env.vars["s"].(str)
+			if !ok {
+				return nil, createTypeError("string->number", "string", env.vars["s"])
+			}
+			radix := 10
+			if r, given := env.vars["radix"]; given {
+				if radix, ok = r.(int); !ok {
+					return nil, createTypeError("string->number", "int", r)
+				}
+				if radix != 2 && radix != 8 && radix != 10 && radix != 16 {
+					return nil, fmt.Errorf("Eval: procedure 'string->number' expected radix 2, 8, 10 or 16, got %d", radix)
+				}
+			}
+			if n, ok := parseNumber(string(s), radix); ok {
+				return n, nil
+			}
+			return false, nil
+		},
+		nil,
+	},
+
+	// (number->string n [radix])
+	"number->string": &proc{
+		[]string{"n", "radix"},
+		arity{1, 1, false},
+		func(env *Env) (interface{}, error) {
+			n := env.vars["n"]
+			if !isNumber(n) {
+				return nil, createTypeError("number->string", "number", n)
+			}
+			radix := 10
+			if r, given := env.vars["radix"]; given {
+				var ok bool
+				if radix, ok = r.(int); !ok {
+					return nil, createTypeError("number->string", "int", r)
+				}
+				if radix != 2 && radix != 8 && radix != 10 && radix != 16 {
+					return nil, fmt.Errorf("Eval: procedure 'number->string' expected radix 2, 8, 10 or 16, got %d", radix)
+				}
+			}
+			if radix == 10 {
+				return str(writeNumber(n)), nil
+			}
+			if !isExactInteger(n) {
+				return nil, fmt.Errorf("Eval: procedure 'number->string' can only write exact integers in radix %d", radix)
+			}
+			return str(toBig(n).Text(radix)), nil
+		},
+		nil,
+	},
+
+	"string-upcase": &proc{
+		[]string{"s"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if s, ok := env.vars["s"].(str); ok {
+				return str(strings.ToUpper(string(s))), nil
+			} else {
+				return nil, createTypeError("string-upcase", "string", env.vars["s"])
+			}
+		},
+		nil,
+	},
+
+	"string-downcase": &proc{
+		[]string{"s"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if s, ok := env.vars["s"].(str); ok {
+				return str(strings.ToLower(string(s))), nil
+			} else {
+				return nil, createTypeError("string-downcase", "string", env.vars["s"])
+			}
+		},
+		nil,
+	},
+
+	// (string-split s [delimiter]) returns a list of the substrings of s
+	// separated by delimiter, or by runs of whitespace if it is omitted
+	"string-split": &proc{
+		[]string{"s", "delimiter"},
+		arity{1, 1, false},
+		func(env *Env) (interface{}, error) {
+			s, ok := env.vars["s"].(str)
+			if !ok {
+				return nil, createTypeError("string-split", "string", env.vars["s"])
+			}
+			var fields []string
+			if d, given := env.vars["delimiter"]; !given {
+				fields = strings.FieldsFunc(string(s), unicode.IsSpace)
+			} else if delim, ok := d.(str); ok {
+				fields = strings.Split(string(s), string(delim))
+			} else {
+				return nil, createTypeError("string-split", "string", d)
+			}
+			elements := make([]interface{}, len(fields))
+			for i, field := range fields {
+				elements[i] = str(field)
+			}
+			return sliceToList(elements), nil
+		},
+		nil,
+	},
+
+	// (string-join list [delimiter]) concatenates a list of strings,
+	// separated by delimiter, which defaults to a single space
+	"string-join": &proc{
+		[]string{"list", "delimiter"},
+		arity{1, 1, false},
+		func(env *Env) (interface{}, error) {
+			elements, ok := listToSlice(env.vars["list"])
+			if !ok {
+				return nil, createTypeError("string-join", "list", env.vars["list"])
+			}
+			delim := str(" ")
+			if d, given := env.vars["delimiter"]; given {
+				if delim, ok = d.(str); !ok {
+					return nil, createTypeError("string-join", "string", d)
+				}
+			}
+			strs := make([]string, len(elements))
+			for i, element := range elements {
+				s, ok := element.(str)
+				if !ok {
+					return nil, createTypeError("string-join", "string", element)
+				}
+				strs[i] = string(s)
+			}
+			return str(strings.Join(strs, string(delim))), nil
+		},
+		nil,
+	},
+}
+
+func init() {
+	for name, v := range stringEnv {
+		defaultEnv[name] = v
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"fmt"
+)
+
+// An alias is an identifier inserted into code by a macro expansion, rather
+// than passed to the macro. Aliases keep expansions hygienic: an alias that
+// code in the expansion binds is bound under a key no other code can refer
+// to, and any other alias means what its name meant where the macro was
+// defined, whatever the code around the macro use binds.
+type alias struct {
+	name interface{} // the identifier in the template: a string, or an alias
+	env  *Env        // the environment the macro was defined in
+	key  string      // the name the alias is bound under
+}
+
+// aliasCount numbers aliases, so each has its own key.
+var aliasCount int
+
+// newAlias returns a fresh alias for the identifier name of a macro defined
+// in env. Its key contains a '~', which identifiers never do.
+func newAlias(name interface{}, env *Env) *alias {
+	aliasCount++
+	return &alias{name, env, fmt.Sprintf("%s~%d", baseName(name), aliasCount)}
+}
+
+// baseName returns the name of the identifier id as it was written, before
+// any renaming, or "" if id is not an identifier.
+func baseName(id interface{}) string {
+	for {
+		switch v := id.(type) {
+		case *alias:
+			id = v.name
+		case string:
+			return v
+		default:
+			return ""
+		}
+	}
+}
+
+// isKeyword reports whether expr is the identifier name, written directly
+// or inserted by a macro.
+func isKeyword(expr interface{}, name string) bool {
+	switch expr.(type) {
+	case string, *alias:
+		return baseName(expr) == name
+	default:
+		return false
+	}
+}
+
+// resolve returns the name the identifier id is bound under as seen from
+// env, and the environment to look it up in.
+func resolve(id interface{}, env *Env) (string, *Env) {
+	for {
+		a, ok := id.(*alias)
+		if !ok {
+			return id.(string), env
+		}
+		if _, ok := env.Lookup(a.key); ok {
+			return a.key, env
+		}
+		id, env = a.name, a.env
+	}
+}
+
+// binding returns the frame that binds the identifier id as seen from env,
+// and the name it is bound under there. The frame is nil if id is unbound.
+func binding(id interface{}, env *Env) (*Env, string) {
+	name, env := resolve(id, env)
+	for ; env != nil; env = env.outer {
+		if _, ok := env.vars[name]; ok {
+			return env, name
+		}
+	}
+	return nil, name
+}
+
+// A transformer rewrites a macro use, form, in env into the code to evaluate
+// in its place.
+type transformer interface {
+	transform(form []interface{}, env *Env) (interface{}, error)
+}
+
+// An expanded is the keyword of a macro use, which the use keeps in place of
+// the keyword once it has been expanded, with its expansion, so that each
+// evaluation of the use evaluates the same expansion.
+type expanded struct {
+	keyword, expansion interface{}
+}
+
+// A macro is a syntax-rules transformer: a form that matches one of the
+// rules' patterns is replaced by the rule's template, filled in with the
+// parts of the form its pattern variables matched. env is the environment
+// the macro was defined in.
+type macro struct {
+	ellipsis string
+	literals []interface{}
+	rules    [][2]interface{}
+	env      *Env
+}
+
+// bindings maps pattern variables to the parts of a form they matched.
+type bindings map[interface{}]interface{}
+
+// An ellipsisMatch holds what a pattern variable followed by an ellipsis
+// matched, one element for each repetition.
+type ellipsisMatch []interface{}
+
+func (m *macro) isEllipsis(expr interface{}) bool {
+	return isKeyword(expr, m.ellipsis)
+}
+
+func (m *macro) isLiteral(expr interface{}) bool {
+	for _, literal := range m.literals {
+		if literal == expr {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLiteral reports whether form, in the macro use's environment env,
+// matches the literal identifier literal: whether both refer to the same
+// binding, or are both unbound and have the same name.
+func (m *macro) matchLiteral(literal, form interface{}, env *Env) bool {
+	if _, ok := identifierName(form); !ok {
+		return false
+	}
+	literalFrame, literalName := binding(literal, m.env)
+	formFrame, formName := binding(form, env)
+	if literalFrame == nil && formFrame == nil {
+		return baseName(literal) == baseName(form)
+	}
+	return literalFrame == formFrame && literalName == formName
+}
+
+// transform returns the expansion of form, a use in env, by the first rule
+// that matches it.
+func (m *macro) transform(form []interface{}, env *Env) (interface{}, error) {
+	for _, rule := range m.rules {
+		// the keyword position is ignored, as if it held _
+		pattern := append([]interface{}{"_"}, rule[0].([]interface{})[1:]...)
+		b := bindings{}
+		if m.match(pattern, form, b, env) {
+			return m.expand(rule[1], b, map[interface{}]*alias{})
+		}
+	}
+	return nil, fmt.Errorf("Eval: no syntax-rules pattern matched '%s'", writeExpr(form))
+}
+
+// match reports whether form, part of a use in env, matches pattern, adding
+// the pattern variables' matches to b.
+func (m *macro) match(pattern, form interface{}, b bindings, env *Env) bool {
+	switch p := pattern.(type) {
+	case string, *alias:
+		if s, ok := p.(string); ok && !isIdentifier(s) {
+			// literal datum, such as a number or string
+			f, ok := form.(string)
+			if !ok || isIdentifier(f) {
+				return false
+			}
+			pv, err := parseLiteral(s)
+			if err != nil {
+				return false
+			}
+			fv, err := parseLiteral(f)
+			return err == nil && equal(pv, fv)
+		}
+		if isKeyword(p, "_") {
+			return true
+		}
+		if m.isLiteral(p) {
+			return m.matchLiteral(p, form, env)
+		}
+		b[p] = form
+		return true
+	case []interface{}:
+		f, ok := form.([]interface{})
+		return ok && m.matchList(p, f, b, env)
+	case vectorLiteral:
+		f, ok := form.(vectorLiteral)
+		return ok && m.matchList(p, f, b, env)
+	default:
+		return false
+	}
+}
+
+// matchList matches a list pattern, which may contain an ellipsis and a
+// dotted tail.
+func (m *macro) matchList(pattern, form []interface{}, b bindings, env *Env) bool {
+	pElements, pTail, err := splitDottedList(pattern)
+	if err != nil {
+		return false
+	}
+	fElements, fTail, err := splitDottedList(form)
+	if err != nil {
+		return false
+	}
+
+	// the elements are matched as before, repeated, after: without an
+	// ellipsis, repeated is empty
+	before, after := pElements, []interface{}{}
+	var repeated interface{}
+	for i := 1; i < len(pElements); i++ {
+		if m.isEllipsis(pElements[i]) {
+			before, repeated, after = pElements[:i-1], pElements[i-1], pElements[i+1:]
+			break
+		}
+	}
+	if len(fElements) < len(before)+len(after) {
+		return false
+	}
+	if repeated == nil && pTail == nil && len(fElements) != len(before) {
+		return false
+	}
+	if pTail == nil && fTail != nil {
+		return false
+	}
+
+	for i, p := range before {
+		if !m.match(p, fElements[i], b, env) {
+			return false
+		}
+	}
+	rest := fElements[len(before):]
+	if repeated != nil {
+		n := len(fElements) - len(after)
+		matches := []bindings{}
+		for _, f := range fElements[len(before):n] {
+			mb := bindings{}
+			if !m.match(repeated, f, mb, env) {
+				return false
+			}
+			matches = append(matches, mb)
+		}
+		for _, v := range m.patternVars(repeated) {
+			seq := make(ellipsisMatch, len(matches))
+			for i, mb := range matches {
+				seq[i] = mb[v]
+			}
+			b[v] = seq
+		}
+		for i, p := range after {
+			if !m.match(p, fElements[n+i], b, env) {
+				return false
+			}
+		}
+		rest = nil
+	}
+	if pTail == nil {
+		return true
+	}
+
+	// the tail pattern matches the rest of the form as a list, or the form's
+	// own tail if nothing is left
+	var restForm interface{} = fTail
+	if len(rest) > 0 || fTail == nil {
+		list := append([]interface{}{}, rest...)
+		if fTail != nil {
+			list = append(list, ".", fTail)
+		}
+		restForm = list
+	}
+	return m.match(pTail, restForm, b, env)
+}
+
+// patternVars returns the pattern variables in pattern.
+func (m *macro) patternVars(pattern interface{}) []interface{} {
+	switch p := pattern.(type) {
+	case string, *alias:
+		if s, ok := p.(string); ok && !isIdentifier(s) {
+			return nil
+		}
+		if isKeyword(p, "_") || m.isEllipsis(p) || m.isLiteral(p) {
+			return nil
+		}
+		return []interface{}{p}
+	case []interface{}:
+		vars := []interface{}{}
+		for _, e := range p {
+			vars = append(vars, m.patternVars(e)...)
+		}
+		return vars
+	case vectorLiteral:
+		return m.patternVars([]interface{}(p))
+	default:
+		return nil
+	}
+}
+
+// expand fills in template with the matches in b. Identifiers in the
+// template that are not pattern variables become aliases, one for each
+// identifier in renames.
+func (m *macro) expand(template interface{}, b bindings, renames map[interface{}]*alias) (interface{}, error) {
+	switch t := template.(type) {
+	case string, *alias:
+		if s, ok := t.(string); ok && !isIdentifier(s) {
+			return t, nil
+		}
+		if v, ok := b[t]; ok {
+			if _, ok := v.(ellipsisMatch); ok {
+				return nil, fmt.Errorf("Eval: syntax-rules pattern variable '%s' used without ellipsis", baseName(t))
+			}
+			return v, nil
+		}
+		if m.isEllipsis(t) {
+			return nil, fmt.Errorf("Eval: syntax-rules template has misplaced ellipsis")
+		}
+		if a, ok := renames[t]; ok {
+			return a, nil
+		}
+		a := newAlias(t, m.env)
+		renames[t] = a
+		return a, nil
+	case []interface{}:
+		if len(t) == 2 && m.isEllipsis(t[0]) {
+			// (... template) inserts template with its ellipses as they are
+			escaped := *m
+			escaped.ellipsis = ""
+			return escaped.expand(t[1], b, renames)
+		}
+		result := []interface{}{}
+		for i := 0; i < len(t); i++ {
+			depth := 0
+			for i+depth+1 < len(t) && m.isEllipsis(t[i+depth+1]) {
+				depth++
+			}
+			if depth == 0 {
+				v, err := m.expand(t[i], b, renames)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, v)
+				continue
+			}
+			vs, err := m.expandEllipsis(t[i], depth, b, renames)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, vs...)
+			i += depth
+		}
+		// splice a list that a pattern variable put after a dot
+		if n := len(result); n >= 2 && result[n-2] == "." {
+			if tail, ok := result[n-1].([]interface{}); ok {
+				result = append(result[:n-2], tail...)
+			}
+		}
+		return result, nil
+	case vectorLiteral:
+		v, err := m.expand([]interface{}(t), b, renames)
+		if err != nil {
+			return nil, err
+		}
+		return vectorLiteral(v.([]interface{})), nil
+	default:
+		return t, nil
+	}
+}
+
+// expandEllipsis expands a subtemplate followed by depth ellipses, once for
+// each repetition its pattern variables matched.
+func (m *macro) expandEllipsis(template interface{}, depth int, b bindings, renames map[interface{}]*alias) ([]interface{}, error) {
+	vars := []interface{}{}
+	n := -1
+	for _, v := range m.patternVars(template) {
+		seq, ok := b[v].(ellipsisMatch)
+		if !ok {
+			continue
+		}
+		if n >= 0 && len(seq) != n {
+			return nil, fmt.Errorf("Eval: syntax-rules pattern variables under one ellipsis matched different numbers of forms")
+		}
+		vars = append(vars, v)
+		n = len(seq)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("Eval: syntax-rules template has an ellipsis with no pattern variable before it")
+	}
+
+	results := []interface{}{}
+	for i := 0; i < n; i++ {
+		ib := bindings{}
+		for k, v := range b {
+			ib[k] = v
+		}
+		for _, v := range vars {
+			ib[v] = b[v].(ellipsisMatch)[i]
+		}
+		if depth > 1 {
+			vs, err := m.expandEllipsis(template, depth-1, ib, renames)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, vs...)
+		} else {
+			v, err := m.expand(template, ib, renames)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, v)
+		}
+	}
+	return results, nil
+}
+
+// writeExpr returns the source text of the expression expr.
+func writeExpr(expr interface{}) string {
+	if v, err := datum(expr); err == nil {
+		return writeString(v)
+	}
+	return fmt.Sprint(expr)
+}
+
+// evalSyntaxBindings evaluates the transformers of a let-syntax or
+// letrec-syntax in specEnv, binding them in bodyEnv.
+func evalSyntaxBindings(name string, bindingList interface{}, specEnv, bodyEnv *Env) error {
+	defs, ok := bindingList.([]interface{})
+	if !ok {
+		return fmt.Errorf("Eval: procedure '%s' expected a list of bindings, but got '%T'", name, bindingList)
+	}
+	for _, def := range defs {
+		binding, ok := def.([]interface{})
+		if !ok || len(binding) != 2 {
+			return fmt.Errorf("Eval: procedure '%s' expected a binding list of length 2, but got '%s'", name, writeExpr(def))
+		}
+		keyword, ok := identifierName(binding[0])
+		if !ok {
+			return createNameError(name, binding[0])
+		}
+		v, err := Eval(binding[1], specEnv)
+		if err != nil {
+			return err
+		}
+		if _, ok := v.(transformer); !ok {
+			return fmt.Errorf("Eval: procedure '%s' expected a transformer, but got '%s'", name, writeString(v))
+		}
+		bodyEnv.Define(keyword, v)
+	}
+	return nil
+}
+
+var syntaxEnv = map[string]interface{}{
+	// (syntax-rules [ellipsis] (literal ...) (pattern template) ...)
+	"syntax-rules": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		m := &macro{"...", nil, nil, env}
+		if len(args) > 0 {
+			if _, ok := identifierName(args[0]); ok {
+				m.ellipsis = baseName(args[0])
+				args = args[1:]
+			}
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("Eval: procedure 'syntax-rules' expected a list of literals")
+		}
+		literals, ok := args[0].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Eval: procedure 'syntax-rules' expected a list of literals, but got '%s'", writeExpr(args[0]))
+		}
+		for _, literal := range literals {
+			if _, ok := identifierName(literal); !ok {
+				return nil, createNameError("syntax-rules", literal)
+			}
+		}
+		m.literals = literals
+		for _, arg := range args[1:] {
+			rule, ok := arg.([]interface{})
+			if !ok || len(rule) != 2 {
+				return nil, fmt.Errorf("Eval: procedure 'syntax-rules' expected a rule of the form (pattern template), but got '%s'", writeExpr(arg))
+			}
+			if pattern, ok := rule[0].([]interface{}); !ok || len(pattern) == 0 {
+				return nil, fmt.Errorf("Eval: procedure 'syntax-rules' expected a pattern list, but got '%s'", writeExpr(rule[0]))
+			}
+			m.rules = append(m.rules, [2]interface{}{rule[0], rule[1]})
+		}
+		return m, nil
+	}},
+
+	// modifies given env
+	"define-syntax": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, createArgLenError("define-syntax", 2, args)
+		}
+		keyword, ok := identifierName(args[0])
+		if !ok {
+			return nil, createNameError("define-syntax", args[0])
+		}
+		return evalThen{args[1], env, func(v interface{}) (interface{}, error) {
+			if _, ok := v.(transformer); !ok {
+				return nil, fmt.Errorf("Eval: procedure 'define-syntax' expected a transformer, but got '%s'", writeString(v))
+			}
+			env.Define(keyword, v)
+			return nil, nil
+		}}, nil
+	}},
+
+	// (let-syntax ((keyword transformer) ...) body ...)
+	"let-syntax": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("Eval: procedure 'let-syntax' expected at least 1 argument, got 0")
+		}
+		bodyEnv := NewEnv(env)
+		if err := evalSyntaxBindings("let-syntax", args[0], env, bodyEnv); err != nil {
+			return nil, err
+		}
+		return evalBody(args[1:], bodyEnv)
+	}},
+
+	// like let-syntax, but the transformers can refer to each other
+	"letrec-syntax": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("Eval: procedure 'letrec-syntax' expected at least 1 argument, got 0")
+		}
+		bodyEnv := NewEnv(env)
+		if err := evalSyntaxBindings("letrec-syntax", args[0], bodyEnv, bodyEnv); err != nil {
+			return nil, err
+		}
+		return evalBody(args[1:], bodyEnv)
+	}},
+}
+
+func init() {
+	for name, v := range syntaxEnv {
+		defaultEnv[name] = v
+	}
+}
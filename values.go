@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// multipleValues is the value of (values v ...) for other than exactly one
+// value. It is a type of its own so that it is never taken for a list, and
+// is passed through like any value until call-with-values or a binding form
+// takes it apart.
+type multipleValues []interface{}
+
+// valuesOf returns the values that v stands for.
+func valuesOf(v interface{}) []interface{} {
+	if m, ok := v.(multipleValues); ok {
+		return m
+	}
+	return []interface{}{v}
+}
+
+// singleValue returns an error for the special form or procedure name if v is
+// multiple values, which can be returned, but not bound to a variable or
+// kept in a data structure.
+func singleValue(name string, v interface{}) error {
+	if m, ok := v.(multipleValues); ok {
+		return fmt.Errorf("Eval: procedure '%s' expected a single value, but got %d values", name, len(m))
+	}
+	return nil
+}
+
+// formals are the names a binding form binds values to: names, and rest for
+// any remaining values as a list, unless rest is empty.
+type formals struct {
+	names []string
+	rest  string
+}
+
+// parseFormals returns the formals expr for the special form name: a list
+// of identifiers, a dotted list of them, or a single identifier for all of
+// the values.
+func parseFormals(name string, expr interface{}) (formals, error) {
+	if rest, ok := identifierName(expr); ok {
+		return formals{nil, rest}, nil
+	}
+	lst, ok := expr.([]interface{})
+	if !ok {
+		return formals{}, createNameError(name, expr)
+	}
+	fixed, tail, err := splitDottedList(lst)
+	if err != nil {
+		return formals{}, err
+	}
+	f := formals{make([]string, len(fixed)), ""}
+	for i := range fixed {
+		if f.names[i], ok = identifierName(fixed[i]); !ok {
+			return formals{}, createNameError(name, fixed[i])
+		}
+	}
+	if tail != nil {
+		if f.rest, ok = identifierName(tail); !ok {
+			return formals{}, createNameError(name, tail)
+		}
+	}
+	return f, nil
+}
+
+// bind binds the formals to values in env.
+func (f formals) bind(name string, values []interface{}, env *Env) error {
+	if len(values) < len(f.names) || (f.rest == "" && len(values) > len(f.names)) {
+		return fmt.Errorf("Eval: procedure '%s' expected %d values, but got %d values", name, len(f.names), len(values))
+	}
+	for i, n := range f.names {
+		env.Define(n, values[i])
+	}
+	if f.rest != "" {
+		env.Define(f.rest, sliceToList(values[len(f.names):]))
+	}
+	return nil
+}
+
+// parseValuesBindings returns the formals and expressions of the bindings
+// ((formals expr) ...) of let-values or let*-values.
+func parseValuesBindings(name string, bindingList interface{}) ([]formals, []interface{}, error) {
+	defs, ok := bindingList.([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("Eval: procedure '%s' expected a list of bindings, but got '%s'", name, writeExpr(bindingList))
+	}
+	allFormals := make([]formals, len(defs))
+	exprs := make([]interface{}, len(defs))
+	for i, def := range defs {
+		binding, ok := def.([]interface{})
+		if !ok || len(binding) != 2 {
+			return nil, nil, fmt.Errorf("Eval: procedure '%s' expected a binding list of length 2, but got '%s'", name, writeExpr(def))
+		}
+		f, err := parseFormals(name, binding[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		allFormals[i], exprs[i] = f, binding[1]
+	}
+	return allFormals, exprs, nil
+}
+
+// bindSequentially evaluates exprs in turn, each in a new environment
+// extending the last, in which it binds the values to the corresponding
+// formals, then evaluates body in the innermost environment.
+func bindSequentially(allFormals []formals, exprs []interface{}, body []interface{}, env *Env) (interface{}, error) {
+	if len(exprs) == 0 {
+		return evalBody(body, NewEnv(env))
+	}
+	return evalThen{exprs[0], env, func(v interface{}) (interface{}, error) {
+		bindingEnv := NewEnv(env)
+		if err := allFormals[0].bind("let*-values", valuesOf(v), bindingEnv); err != nil {
+			return nil, err
+		}
+		return bindSequentially(allFormals[1:], exprs[1:], body, bindingEnv)
+	}}, nil
+}
+
+// writeValues returns the written values of m, separated by spaces.
+func writeValues(m multipleValues) string {
+	strs := make([]string, len(m))
+	for i, v := range m {
+		strs[i] = writeString(v)
+	}
+	return strings.Join(strs, " ")
+}
+
+var valuesEnv = map[string]interface{}{
+	// (values v ...) returns its arguments as multiple values
+	"values": &proc{
+		[]string{"args"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			args := env.vars["args"].([]interface{})
+			if len(args) == 1 {
+				return args[0], nil
+			}
+			return multipleValues(append([]interface{}{}, args...)), nil
+		},
+		nil,
+	},
+
+	// (call-with-values producer consumer) calls consumer with the values
+	// that calling producer returns
+	"call-with-values": &proc{
+		[]string{"producer", "consumer"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			consumer := env.vars["consumer"]
+			return applyThen{env.vars["producer"], []interface{}{}, func(v interface{}) (interface{}, error) {
+				return applyThen{consumer, valuesOf(v), nil}, nil
+			}}, nil
+		},
+		nil,
+	},
+
+	// (receive formals expr body ...) binds formals to the values of expr
+	"receive": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) < 3 {
+			return nil, fmt.Errorf("Eval: procedure 'receive' expected at least 3 arguments, but got %d arguments", len(args))
+		}
+		f, err := parseFormals("receive", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return evalThen{args[1], env, func(v interface{}) (interface{}, error) {
+			bodyEnv := NewEnv(env)
+			if err := f.bind("receive", valuesOf(v), bodyEnv); err != nil {
+				return nil, err
+			}
+			return evalBody(args[2:], bodyEnv)
+		}}, nil
+	}},
+
+	// (let-values ((formals expr) ...) body ...) binds each formals to the
+	// values of its expr, which are evaluated in the enclosing environment
+	"let-values": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("Eval: procedure 'let-values' expected at least 2 arguments, but got %d arguments", len(args))
+		}
+		allFormals, exprs, err := parseValuesBindings("let-values", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return evalList(exprs, env, make([]interface{}, 0, len(exprs)), func(vals []interface{}) (interface{}, error) {
+			bodyEnv := NewEnv(env)
+			for i, f := range allFormals {
+				if err := f.bind("let-values", valuesOf(vals[i]), bodyEnv); err != nil {
+					return nil, err
+				}
+			}
+			return evalBody(args[1:], bodyEnv)
+		})
+	}},
+
+	// like let-values, but each expr is evaluated with the bindings before
+	// it
+	"let*-values": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("Eval: procedure 'let*-values' expected at least 2 arguments, but got %d arguments", len(args))
+		}
+		allFormals, exprs, err := parseValuesBindings("let*-values", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return bindSequentially(allFormals, exprs, args[1:], env)
+	}},
+
+	// (define-values formals expr) modifies given env
+	"define-values": &specialForm{func(args []interface{}, env *Env) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, createArgLenError("define-values", 2, args)
+		}
+		f, err := parseFormals("define-values", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return evalThen{args[1], env, func(v interface{}) (interface{}, error) {
+			return nil, f.bind("define-values", valuesOf(v), env)
+		}}, nil
+	}},
+
+	// (truncate/ a b) returns the quotient and remainder of a and b
+	"truncate/": &proc{
+		[]string{"a", "b"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			q, err := numberEnv["quotient"].(*proc).body(env)
+			if err != nil {
+				return nil, err
+			}
+			r, err := numberEnv["remainder"].(*proc).body(env)
+			if err != nil {
+				return nil, err
+			}
+			return multipleValues{q, r}, nil
+		},
+		nil,
+	},
+
+	// (floor/ a b) returns the quotient of a and b rounded down, and the
+	// modulo
+	"floor/": &proc{
+		[]string{"a", "b"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			m, err := numberEnv["modulo"].(*proc).body(env)
+			if err != nil {
+				return nil, err
+			}
+			q, err := numDiv(numSub(env.vars["a"], m), env.vars["b"])
+			if err != nil {
+				return nil, err
+			}
+			return multipleValues{q, m}, nil
+		},
+		nil,
+	},
+}
+
+func init() {
+	for name, v := range valuesEnv {
+		defaultEnv[name] = v
+	}
+}
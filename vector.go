@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+)
+
+// A vector is a Scheme vector, a fixed-length sequence indexed in constant
+// time. Vectors are always handled through pointers, so that vector-set!
+// is seen by every reference to the vector.
+type vector struct {
+	elements []interface{}
+}
+
+// maxVectorLength bounds the length make-vector accepts, so that a huge length
+// is reported as an error rather than exhausting memory.
+const maxVectorLength = 1 << 24
+
+// checkRange returns the start and end indices given by the optional
+// arguments args into a sequence of length n, which default to the whole
+// sequence.
+func checkRange(name string, args []interface{}, n int) (int, int, error) {
+	start, end := 0, n
+	var err error
+	if len(args) > 0 {
+		if start, err = checkIndex(name, args[0], n, true); err != nil {
+			return 0, 0, err
+		}
+	}
+	if len(args) > 1 {
+		if end, err = checkIndex(name, args[1], n, true); err != nil {
+			return 0, 0, err
+		}
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("Eval: procedure '%s' start %d is after end %d", name, start, end)
+	}
+	return start, end, nil
+}
+
+// mapVectors calls f on the elements of vectors at each index, up to the
+// length of the shortest vector, and continues by calling then with the
+// results.
+func mapVectors(name string, f interface{}, vectors []interface{}, then func(results []interface{}) (interface{}, error)) (interface{}, error) {
+	n := -1
+	for _, v := range vectors {
+		vec, ok := v.(*vector)
+		if !ok {
+			return nil, createTypeError(name, "vector", v)
+		}
+		if n < 0 || len(vec.elements) < n {
+			n = len(vec.elements)
+		}
+	}
+	var mapFrom func(results []interface{}) (interface{}, error)
+	mapFrom = func(results []interface{}) (interface{}, error) {
+		i := len(results)
+		if i == n {
+			return then(results)
+		}
+		args := make([]interface{}, len(vectors))
+		for j, v := range vectors {
+			args[j] = v.(*vector).elements[i]
+		}
+		return applyThen{f, args, func(result interface{}) (interface{}, error) {
+			// copy results, as the call may return more than once
+			return mapFrom(append(results[:i:i], result))
+		}}, nil
+	}
+	return mapFrom(make([]interface{}, 0, n))
+}
+
+var vectorEnv = map[string]interface{}{
+	"vector?": &proc{
+		[]string{"a"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			_, ok := env.vars["a"].(*vector)
+			return ok, nil
+		},
+		nil,
+	},
+
+	// (make-vector k [fill]), where fill defaults to #f
+	"make-vector": &proc{
+		[]string{"k", "fill"},
+		arity{1, 1, false},
+		func(env *Env) (interface{}, error) {
+			k, ok := env.vars["k"].(int)
+			if !ok {
+				return nil, createTypeError("make-vector", "int", env.vars["k"])
+			}
+			if k < 0 {
+				return nil, fmt.Errorf("Eval: procedure 'make-vector' expected a non-negative length, but got %d", k)
+			}
+			if k > maxVectorLength {
+				return nil, fmt.Errorf("Eval: procedure 'make-vector' expected a length of at most %d, but got %d", maxVectorLength, k)
+			}
+			fill, given := env.vars["fill"]
+			if !given {
+				fill = false
+			}
+			elements := make([]interface{}, k)
+			for i := range elements {
+				elements[i] = fill
+			}
+			return &vector{elements}, nil
+		},
+		nil,
+	},
+
+	"vector": &proc{
+		[]string{"elements"},
+		arity{0, 0, true},
+		func(env *Env) (interface{}, error) {
+			elements := env.vars["elements"].([]interface{})
+			return &vector{append([]interface{}{}, elements...)}, nil
+		},
+		nil,
+	},
+
+	"vector-length": &proc{
+		[]string{"v"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if v, ok := env.vars["v"].(*vector); ok {
+				return len(v.elements), nil
+			} else {
+				return nil, createTypeError("vector-length", "vector", env.vars["v"])
+			}
+		},
+		nil,
+	},
+
+	"vector-ref": &proc{
+		[]string{"v", "k"},
+		arity{2, 0, false},
+		func(env *Env) (interface{}, error) {
+			v, ok := env.vars["v"].(*vector)
+			if !ok {
+				return nil, createTypeError("vector-ref", "vector", env.vars["v"])
+			}
+			k, err := checkIndex("vector-ref", env.vars["k"], len(v.elements), false)
+			if err != nil {
+				return nil, err
+			}
+			return v.elements[k], nil
+		},
+		nil,
+	},
+
+	"vector-set!": &proc{
+		[]string{"v", "k", "a"},
+		arity{3, 0, false},
+		func(env *Env) (interface{}, error) {
+			v, ok := env.vars["v"].(*vector)
+			if !ok {
+				return nil, createTypeError("vector-set!", "vector", env.vars["v"])
+			}
+			k, err := checkIndex("vector-set!", env.vars["k"], len(v.elements), false)
+			if err != nil {
+				return nil, err
+			}
+			v.elements[k] = env.vars["a"]
+			return nil, nil
+		},
+		nil,
+	},
+
+	// (vector->list v [start [end]])
+	"vector->list": &proc{
+		[]string{"v", "start", "end"},
+		arity{1, 2, false},
+		func(env *Env) (interface{}, error) {
+			v, ok := env.vars["v"].(*vector)
+			if !ok {
+				return nil, createTypeError("vector->list", "vector", env.vars["v"])
+			}
+			start, end, err := checkRange("vector->list", optionalArgs(env, "start", "end"), len(v.elements))
+			if err != nil {
+				return nil, err
+			}
+			return sliceToList(v.elements[start:end]), nil
+		},
+		nil,
+	},
+
+	"list->vector": &proc{
+		[]string{"l"},
+		arity{1, 0, false},
+		func(env *Env) (interface{}, error) {
+			if elements, ok := listToSlice(env.vars["l"]); ok {
+				return &vector{elements}, nil
+			} else {
+				return nil, createTypeError("list->vector", "list", env.vars["l"])
+			}
+		},
+		nil,
+	},
+
+	// (vector-fill! v fill [start [end]])
+	"vector-fill!": &proc{
+		[]string{"v", "fill", "start", "end"},
+		arity{2, 2, false},
+		func(env *Env) (interface{}, error) {
+			v, ok := env.vars["v"].(*vector)
+			if !ok {
+				return nil, createTypeError("vector-fill!", "vector", env.vars["v"])
+			}
+			start, end, err := checkRange("vector-fill!", optionalArgs(env, "start", "end"), len(v.elements))
+			if err != nil {
+				return nil, err
+			}
+			for i := start; i < end; i++ {
+				v.elements[i] = env.vars["fill"]
+			}
+			return nil, nil
+		},
+		nil,
+	},
+
+	// (vector-copy v [start [end]])
+	"vector-copy": &proc{
+		[]string{"v", "start", "end"},
+		arity{1, 2, false},
+		func(env *Env) (interface{}, error) {
+			v, ok := env.vars["v"].(*vector)
+			if !ok {
+				return nil, createTypeError("vector-copy", "vector", env.vars["v"])
+			}
+			start, end, err := checkRange("vector-copy", optionalArgs(env, "start", "end"), len(v.elements))
+			if err != nil {
+				return nil, err
+			}
+			return &vector{append([]interface{}{}, v.elements[start:end]...)}, nil
+		},
+		nil,
+	},
+
+	// (vector-map f v1 v2 ...)
+	"vector-map": &proc{
+		[]string{"f", "v", "vectors"},
+		arity{2, 0, true},
+		func(env *Env) (interface{}, error) {
+			vectors := append([]interface{}{env.vars["v"]}, env.vars["vectors"].([]interface{})...)
+			return mapVectors("vector-map", env.vars["f"], vectors, func(results []interface{}) (interface{}, error) {
+				for _, result := range results {
+					if err := singleValue("vector-map", result); err != nil {
+						return nil, err
+					}
+				}
+				return &vector{results}, nil
+			})
+		},
+		nil,
+	},
+
+	// (vector-for-each f v1 v2 ...)
+	"vector-for-each": &proc{
+		[]string{"f", "v", "vectors"},
+		arity{2, 0, true},
+		func(env *Env) (interface{}, error) {
+			vectors := append([]interface{}{env.vars["v"]}, env.vars["vectors"].([]interface{})...)
+			return mapVectors("vector-for-each", env.vars["f"], vectors, func([]interface{}) (interface{}, error) {
+				return nil, nil
+			})
+		},
+		nil,
+	},
+}
+
+func init() {
+	for name, v := range vectorEnv {
+		defaultEnv[name] = v
+	}
+}